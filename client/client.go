@@ -6,13 +6,21 @@ import (
 
 	"github.com/micro-kit/micro-common/logger"
 	"github.com/micro-kit/microkit/internal/common"
+	"github.com/micro-kit/microkit/plugins/balancer/consistenthash" // 注册负载均衡器
+	_ "github.com/micro-kit/microkit/plugins/balancer/leastrequest"
+	_ "github.com/micro-kit/microkit/plugins/balancer/locality"
+	"github.com/micro-kit/microkit/plugins/balancer/outlier"
+	_ "github.com/micro-kit/microkit/plugins/balancer/p2c"
+	"github.com/micro-kit/microkit/plugins/balancer/route"
+	"github.com/micro-kit/microkit/plugins/balancer/wrr"
 	"github.com/micro-kit/microkit/plugins/middleware"
+	"github.com/micro-kit/microkit/plugins/middleware/hedge"
 	"github.com/micro-kit/microkit/plugins/middleware/hystrixlimitter"
 	zap "github.com/micro-kit/microkit/plugins/middleware/logger"
 	"github.com/micro-kit/microkit/plugins/middleware/opentracing"
 	"github.com/micro-kit/microkit/plugins/middleware/prometheus"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/balancer/roundrobin"
 )
 
 /*
@@ -27,13 +35,16 @@ type Client struct {
 	tracerCloser io.Closer        // 链路追踪关闭
 }
 
-// NewDefaultClient 创建默认客户端对象
+// NewDefaultClient 创建默认客户端对象，通过 Middleware 设置的中间件添加在默认中间件之后
 func NewDefaultClient(opts ...Option) (*Client, error) {
 	c := &Client{
 		opts: new(Options),
 	}
 	// 配置
-	configure(c, opts...)
+	err := configure(c, opts...)
+	if err != nil {
+		return nil, err
+	}
 	// 服务名检查
 	if c.opts.serviceName == "" {
 		return nil, errors.New("Service name must be set")
@@ -49,22 +60,35 @@ func NewDefaultClient(opts ...Option) (*Client, error) {
 		return nil, err
 	}
 	c.tracerCloser = closer // 保存链路追踪关闭对象
-	middlewares = append(middlewares, opentracing.NewOpentracing(
+	tracing, err := opentracing.NewOpentracing(
 		opentracing.Logger(logger.Logger),
 		opentracing.Tracer(tracer),
-	))
+	)
+	if err != nil {
+		return nil, err
+	}
+	middlewares = append(middlewares, tracing)
 	// 监控中间件
 	middlewares = append(middlewares, prometheus.NewPrometheus(prometheus.Enable(true)))
 	// 熔断限流中间件
-	middlewares = append(middlewares, hystrixlimitter.NewHystrixLimitter(
+	limitter, err := hystrixlimitter.NewHystrixLimitter(
 		hystrixlimitter.Type(hystrixlimitter.HystrixLimitterTypeClient),
 		hystrixlimitter.Logger(logger.Logger),
 		hystrixlimitter.ServiceName(c.opts.serviceName),
-	))
+	)
+	if err != nil {
+		return nil, err
+	}
+	middlewares = append(middlewares, limitter)
+	// 调用方设置的中间件(如重试、对冲)在默认中间件之后执行
+	middlewares = append(middlewares, c.opts.middlewares...)
 
 	// 再次配置
 	opts = append(opts, Middleware(middlewares...))
-	configure(c, opts...)
+	err = configure(c, opts...)
+	if err != nil {
+		return nil, err
+	}
 
 	return c, nil
 }
@@ -75,7 +99,10 @@ func NewClient(opts ...Option) (*Client, error) {
 		opts: new(Options),
 	}
 	// 配置
-	configure(c, opts...)
+	err := configure(c, opts...)
+	if err != nil {
+		return nil, err
+	}
 	// 服务名检查
 	if c.opts.serviceName == "" {
 		return nil, errors.New("Service name must be set")
@@ -85,7 +112,7 @@ func NewClient(opts ...Option) (*Client, error) {
 }
 
 // 配置设置项
-func configure(c *Client, ops ...Option) {
+func configure(c *Client, ops ...Option) error {
 	// 处理设置参数
 	for _, o := range ops {
 		o(c.opts)
@@ -94,9 +121,30 @@ func configure(c *Client, ops ...Option) {
 	if c.opts.connTimeout <= 0 {
 		c.opts.connTimeout = defaultConnTimeout
 	}
+	// 按版本路由使用路由负载均衡器，不能同时指定其它负载均衡器
+	if c.opts.router != nil && c.opts.balancer != "" && c.opts.balancer != route.Name {
+		return errors.New("Router and Balancer can not be set at the same time")
+	}
 	if c.opts.reg == nil {
-		c.opts.reg = common.NewClientEtcdRegister(c.opts.serviceName)
+		reg, err := common.NewClientEtcdRegister(c.opts.serviceName)
+		if err != nil {
+			return err
+		}
+		c.opts.reg = reg
 	}
+	return nil
+}
+
+// 实际使用的负载均衡器名称
+func (c *Client) balancerName() string {
+	if c.opts.router != nil {
+		// 按版本路由需要配合路由负载均衡器
+		return route.Name
+	}
+	if c.opts.balancer == "" {
+		return wrr.Name
+	}
+	return c.opts.balancer
 }
 
 // NewGrpcClient 用户生成客户端对象
@@ -104,16 +152,64 @@ type NewGrpcClient func(*grpc.ClientConn)
 
 // Dial 连接grpc服务端，并构造多客户端
 func (c *Client) Dial(clients ...NewGrpcClient) error {
-	// 注册中间件获取客户端发现对象
+	// 注册中间件获取客户端发现对象 - 只对当前连接生效，不注册到全局
 	r := c.opts.reg.GetBuilder()
-	resolver.Register(r)
 	// grpc连接配置
 	opts := make([]grpc.DialOption, 0)
 	opts = append(opts,
-		grpc.WithBalancerName("round_robin"), // 轮训调用
-		grpc.WithInsecure(),                  // 禁用连接安全检查
+		grpc.WithResolvers(r),                // 服务发现
 		grpc.WithTimeout(c.opts.connTimeout), // 连接超时
 	)
+	// 负载均衡，启用节点异常检测时通过服务配置包装负载均衡器
+	balancerName := c.balancerName()
+	if c.opts.outlier != nil {
+		cfg := *c.opts.outlier
+		cfg.ChildPolicy = balancerName
+		sc, err := outlier.ServiceConfig(&cfg)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, grpc.WithDefaultServiceConfig(sc))
+	} else {
+		opts = append(opts, grpc.WithBalancerName(balancerName))
+	}
+	// 连接安全配置
+	if c.opts.tls {
+		reloader, err := common.NewTLSReloader(c.opts.tlsCertFile, c.opts.tlsKeyFile, c.opts.tlsCAFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, grpc.WithTransportCredentials(reloader.ClientCredentials(c.opts.tlsServerName, c.opts.tlsInsecureSkipVerify)))
+	} else {
+		opts = append(opts, grpc.WithInsecure()) // 禁用连接安全检查
+	}
+	// 组织流式调用和普通调用中间件列表
+	streamInterceptors := make([]grpc.StreamClientInterceptor, 0)
+	unaryInterceptors := make([]grpc.UnaryClientInterceptor, 0)
+	for _, v := range c.opts.middlewares {
+		// grpc 自带负载均衡器不会为对冲副本选择不同节点
+		if _, ok := v.(*hedge.Hedge); ok && (balancerName == roundrobin.Name || balancerName == grpc.PickFirstBalancerName) {
+			logger.Logger.Warnw("对冲请求中间件需要使用 microkit 提供的负载均衡器，副本可能发送到同一节点", "balancer", balancerName, "service_name", c.opts.serviceName)
+		}
+		streamInterceptors = append(streamInterceptors, v.StreamClient)
+		unaryInterceptors = append(unaryInterceptors, v.UnaryClient)
+	}
+	// 一致性哈希在其它中间件之后读取哈希key
+	if c.opts.hashKey != "" {
+		streamInterceptors = append(streamInterceptors, consistenthash.StreamClientInterceptor(c.opts.hashKey))
+		unaryInterceptors = append(unaryInterceptors, consistenthash.UnaryClientInterceptor(c.opts.hashKey))
+	}
+	// 按版本路由在其它中间件之后设置目标版本
+	if c.opts.router != nil {
+		streamInterceptors = append(streamInterceptors, c.opts.router.StreamClient)
+		unaryInterceptors = append(unaryInterceptors, c.opts.router.UnaryClient)
+	}
+	opts = append(opts,
+		grpc.WithStreamInterceptor(middleware.ChainStreamClient(streamInterceptors...)),
+		grpc.WithUnaryInterceptor(middleware.ChainUnaryClient(unaryInterceptors...)),
+	)
+	// 用户自定义连接配置
+	opts = append(opts, c.opts.dialOptions...)
 	// 连接服务
 	conn, err := grpc.Dial(r.Scheme()+"://author/"+c.opts.serviceName, opts...)
 	if err != nil {
@@ -127,6 +223,11 @@ func (c *Client) Dial(clients ...NewGrpcClient) error {
 	return nil
 }
 
+// Conn 获取grpc连接，Dial 之前为nil
+func (c *Client) Conn() *grpc.ClientConn {
+	return c.conn
+}
+
 // Close 关闭连接 - 服务结束时
 func (c *Client) Close() {
 	// grpc 连接
@@ -3,8 +3,11 @@ package client
 import (
 	"time"
 
+	"github.com/micro-kit/microkit/plugins/balancer/outlier"
+	"github.com/micro-kit/microkit/plugins/balancer/route"
 	"github.com/micro-kit/microkit/plugins/middleware"
 	"github.com/micro-kit/microkit/plugins/register"
+	"google.golang.org/grpc"
 )
 
 /* 客户端配置 */
@@ -22,6 +25,18 @@ type Options struct {
 	middlewares []middleware.Middleware // 中间件
 	reg         register.Register       // 注册中间件
 	connTimeout time.Duration           // 连接超时
+	dialOptions []grpc.DialOption       // 自定义grpc连接配置
+	balancer    string                  // 负载均衡器名称
+	hashKey     string                  // 一致性哈希读取哈希key的请求metadata
+	router      *route.Router           // 按版本路由
+	outlier     *outlier.Config         // 节点异常检测
+
+	tls                   bool   // 是否启用tls加密连接
+	tlsCAFile             string // 验证服务端证书的ca证书，为空使用系统根证书
+	tlsCertFile           string // 客户端证书，用于 mTLS
+	tlsKeyFile            string // 客户端私钥
+	tlsServerName         string // 验证服务端证书使用的域名
+	tlsInsecureSkipVerify bool   // 跳过服务端证书验证，仅用于测试
 }
 
 // ServiceName 服务名
@@ -45,9 +60,91 @@ func Register(reg register.Register) Option {
 	}
 }
 
+// Balancer 负载均衡器名称，默认 wrr.Name，节点未设置权重时与 round_robin 相同
+// 可选 wrr.Name(加权轮询) leastrequest.Name(最少进行中请求) p2c.Name(P2C-EWMA) consistenthash.Name(一致性哈希)
+// locality.Name(就近调用)，或其它已注册到grpc的负载均衡器
+// 使用对冲请求中间件时需要使用 microkit 提供的负载均衡器，副本才会发送到不同节点
+func Balancer(name string) Option {
+	return func(o *Options) {
+		o.balancer = name
+	}
+}
+
+// HashMetadataKey 一致性哈希负载均衡器读取哈希key的请求metadata，默认 consistenthash.DefaultMetadataKey
+// 用于同一进程中不同客户端按不同metadata粘滞调用，配合 Balancer(consistenthash.Name) 使用
+func HashMetadataKey(key string) Option {
+	return func(o *Options) {
+		o.hashKey = key
+	}
+}
+
+// Router 按版本路由，规则可在运行时更新，设置后使用 route.Name 负载均衡器，不能同时设置 Balancer
+func Router(router *route.Router) Option {
+	return func(o *Options) {
+		o.router = router
+	}
+}
+
+// OutlierDetection 启用节点异常检测，连续返回 Unavailable 或超时、成功率过低的节点被暂时摘除
+// 节点仍由 Balancer 设置的负载均衡器选择，cfg 为nil时使用默认配置
+func OutlierDetection(cfg *outlier.Config) Option {
+	return func(o *Options) {
+		if cfg == nil {
+			cfg = new(outlier.Config)
+		}
+		o.outlier = cfg
+	}
+}
+
 // ConnTimeout 设置连接超时
 func ConnTimeout(connTimeout time.Duration) Option {
 	return func(o *Options) {
 		o.connTimeout = connTimeout
 	}
 }
+
+// DialOption 自定义grpc连接配置，在默认配置之后追加
+func DialOption(opts ...grpc.DialOption) Option {
+	return func(o *Options) {
+		o.dialOptions = opts
+	}
+}
+
+// TLS 启用tls加密连接，设置了 TLSCA 或 TLSCert 时自动启用
+func TLS(enable bool) Option {
+	return func(o *Options) {
+		o.tls = enable
+	}
+}
+
+// TLSCA 验证服务端证书的ca证书，文件变化后自动重新加载
+func TLSCA(caFile string) Option {
+	return func(o *Options) {
+		o.tls = true
+		o.tlsCAFile = caFile
+	}
+}
+
+// TLSCert 客户端证书，用于连接启用 mTLS 的服务，文件变化后自动重新加载
+func TLSCert(certFile, keyFile string) Option {
+	return func(o *Options) {
+		o.tls = true
+		o.tlsCertFile = certFile
+		o.tlsKeyFile = keyFile
+	}
+}
+
+// TLSServerName 验证服务端证书使用的域名，默认使用服务名(连接的 authority)而不是节点地址
+// 未设置时服务端证书需要包含服务名的 SAN
+func TLSServerName(serverName string) Option {
+	return func(o *Options) {
+		o.tlsServerName = serverName
+	}
+}
+
+// TLSInsecureSkipVerify 跳过服务端证书验证，仅用于测试环境
+func TLSInsecureSkipVerify(skip bool) Option {
+	return func(o *Options) {
+		o.tlsInsecureSkipVerify = skip
+	}
+}
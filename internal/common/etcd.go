@@ -1,6 +1,7 @@
 package common
 
 import (
+	"os"
 	"strings"
 
 	"github.com/micro-kit/micro-common/config"
@@ -9,28 +10,61 @@ import (
 	"github.com/micro-kit/microkit/plugins/register/etcdv3"
 )
 
+// etcd 连接配置环境变量
+const (
+	envETCDSecure   = "ETCD_SECURE"       // 是否使用tls连接 true|false
+	envETCDCAFile   = "ETCD_CA_FILE"      // 验证etcd服务端证书的ca证书
+	envETCDCertFile = "ETCD_CERT_FILE"    // etcd客户端证书
+	envETCDKeyFile  = "ETCD_KEY_FILE"     // etcd客户端私钥
+	envETCDUsername = "ETCD_USERNAME"     // etcd认证用户名
+	envETCDPassword = "ETCD_PASSWORD"     // etcd认证密码
+	envETCDLazy     = "ETCD_LAZY_CONNECT" // etcd不可用时是否在后台持续重试连接和注册 true|false
+	envETCDSnapshot = "ETCD_SNAPSHOT_DIR" // 服务节点快照目录，etcd不可用时客户端使用快照中的服务节点
+)
+
 // NewServerEtcdRegister 获取一个etcd注册中间件 - 配置从环境变量获取
-func NewServerEtcdRegister() register.Register {
-	etcdAddrs := strings.Split(config.GetETCDAddr(), ";")
-	reg := etcdv3.NewRegistry(
-		register.Addrs(etcdAddrs...),
-		register.TTL(config.GetRegisterTTL()),
-		register.Name(config.GetSvcName()),
-		register.Schema(config.GetSchema()),
-		register.Logger(logger.Logger),
-	)
-	return reg
+func NewServerEtcdRegister() (register.Register, error) {
+	opts, err := etcdOptions(config.GetSvcName())
+	if err != nil {
+		return nil, err
+	}
+	return etcdv3.NewRegistry(opts...)
 }
 
 // NewClientEtcdRegister 创建客户端注册对象
-func NewClientEtcdRegister(svcName string) register.Register {
+func NewClientEtcdRegister(svcName string) (register.Register, error) {
+	opts, err := etcdOptions(svcName)
+	if err != nil {
+		return nil, err
+	}
+	return etcdv3.NewRegistry(opts...)
+}
+
+// etcd注册中间件配置 - 从环境变量获取
+func etcdOptions(svcName string) ([]register.Option, error) {
 	etcdAddrs := strings.Split(config.GetETCDAddr(), ";")
-	reg := etcdv3.NewRegistry(
+	opts := []register.Option{
 		register.Addrs(etcdAddrs...),
 		register.TTL(config.GetRegisterTTL()),
 		register.Name(svcName),
 		register.Schema(config.GetSchema()),
 		register.Logger(logger.Logger),
-	)
-	return reg
+		register.Auth(os.Getenv(envETCDUsername), os.Getenv(envETCDPassword)),
+		register.LazyConnect(os.Getenv(envETCDLazy) == "true"),
+		register.SnapshotDir(os.Getenv(envETCDSnapshot)),
+	}
+	// tls加密连接
+	caFile := os.Getenv(envETCDCAFile)
+	certFile := os.Getenv(envETCDCertFile)
+	keyFile := os.Getenv(envETCDKeyFile)
+	if os.Getenv(envETCDSecure) == "true" || caFile != "" || certFile != "" {
+		opts = append(opts, register.Secure(true))
+		reloader, err := NewTLSReloader(certFile, keyFile, caFile)
+		if err != nil {
+			logger.Logger.Errorw("加载etcd tls证书错误", "err", err, "ca", caFile, "cert", certFile)
+			return nil, err
+		}
+		opts = append(opts, register.TLSConfig(reloader.ClientConfig("", false)))
+	}
+	return opts, nil
 }
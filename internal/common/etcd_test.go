@@ -0,0 +1,85 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/micro-kit/microkit/plugins/register"
+)
+
+// 设置环境变量，返回恢复函数
+func setenv(t *testing.T, kv map[string]string) func() {
+	t.Helper()
+	for k, v := range kv {
+		if err := os.Setenv(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() {
+		for k := range kv {
+			os.Unsetenv(k)
+		}
+	}
+}
+
+// 应用注册中间件配置
+func applyOptions(ops []register.Option) *register.Options {
+	o := new(register.Options)
+	for _, op := range ops {
+		op(o)
+	}
+	return o
+}
+
+func TestEtcdOptionsAuth(t *testing.T) {
+	defer setenv(t, map[string]string{envETCDUsername: "user", envETCDPassword: "pass"})()
+	ops, err := etcdOptions("svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := applyOptions(ops)
+	if o.Username != "user" || o.Password != "pass" {
+		t.Errorf("认证信息 = %s/%s, want user/pass", o.Username, o.Password)
+	}
+	if o.Secure || o.TLSConfig != nil {
+		t.Error("未配置证书时使用了tls连接")
+	}
+}
+
+func TestEtcdOptionsTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "microkit-etcd-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := func(name string) string { return filepath.Join(dir, name) }
+	ca := newTestCert(t, "ca", nil)
+	ca.write(t, file("ca.pem"), "", time.Now())
+	newTestCert(t, "client", ca).write(t, file("client.pem"), file("client.key"), time.Now())
+
+	defer setenv(t, map[string]string{
+		envETCDCAFile:   file("ca.pem"),
+		envETCDCertFile: file("client.pem"),
+		envETCDKeyFile:  file("client.key"),
+	})()
+	ops, err := etcdOptions("svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := applyOptions(ops)
+	if !o.Secure || o.TLSConfig == nil {
+		t.Fatal("配置证书后未使用tls连接")
+	}
+	if o.TLSConfig.RootCAs == nil || len(o.TLSConfig.Certificates) != 1 {
+		t.Error("tls配置未包含ca证书和客户端证书")
+	}
+
+	// 证书加载失败时返回错误
+	os.Setenv(envETCDCertFile, file("not-exist.pem"))
+	if _, err := etcdOptions("svc"); err == nil {
+		t.Error("证书文件不存在时 etcdOptions() 未返回错误")
+	}
+}
@@ -0,0 +1,27 @@
+package common
+
+import (
+	"os"
+)
+
+// 服务注册附加信息环境变量，在服务端和客户端连接创建时读取，不在包初始化时缓存
+const (
+	envZone    = "SVC_ZONE"    // 可用区
+	envRegion  = "SVC_REGION"  // 地域
+	envVersion = "SVC_VERSION" // 服务版本
+)
+
+// GetZone 当前节点所在可用区
+func GetZone() string {
+	return os.Getenv(envZone)
+}
+
+// GetRegion 当前节点所在地域
+func GetRegion() string {
+	return os.Getenv(envRegion)
+}
+
+// GetVersion 当前节点服务版本
+func GetVersion() string {
+	return os.Getenv(envVersion)
+}
@@ -0,0 +1,247 @@
+package common
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/micro-kit/micro-common/logger"
+	"google.golang.org/grpc/credentials"
+)
+
+/* tls证书热加载 */
+
+const (
+	// 检查证书文件是否变化的间隔
+	tlsReloadInterval = 10 * time.Second
+)
+
+// TLSReloader 证书热加载，握手时按间隔检查证书文件修改时间，文件变化后重新加载
+type TLSReloader struct {
+	certFile string // 证书
+	keyFile  string // 私钥
+	caFile   string // ca证书，可以为空
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	caPool    *x509.CertPool
+	modTime   time.Time // 已加载文件的最新修改时间
+	lastCheck time.Time // 上次检查时间
+}
+
+// NewTLSReloader 创建证书热加载对象，首次加载失败返回错误
+func NewTLSReloader(certFile, keyFile, caFile string) (*TLSReloader, error) {
+	r := &TLSReloader{
+		certFile:  certFile,
+		keyFile:   keyFile,
+		caFile:    caFile,
+		lastCheck: time.Now(),
+	}
+	err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// 加载证书文件
+func (r *TLSReloader) load() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	var cert *tls.Certificate
+	if r.certFile != "" || r.keyFile != "" {
+		c, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return err
+		}
+		cert = &c
+	}
+	var caPool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := ioutil.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+		caPool = x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("ca证书解析失败: %s", r.caFile)
+		}
+	}
+	r.cert = cert
+	r.caPool = caPool
+	r.modTime = modTime
+	return nil
+}
+
+// 证书文件最新修改时间
+func (r *TLSReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile, r.caFile} {
+		if name == "" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return latest, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// 获取当前证书，文件变化时重新加载，加载失败继续使用旧证书
+func (r *TLSReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if now.Sub(r.lastCheck) < tlsReloadInterval {
+		return r.cert, r.caPool
+	}
+	r.lastCheck = now
+	modTime, err := r.latestModTime()
+	if err != nil {
+		logger.Logger.Errorw("检查tls证书文件错误，继续使用已加载证书", "err", err, "cert", r.certFile, "ca", r.caFile)
+		return r.cert, r.caPool
+	}
+	if modTime.Equal(r.modTime) {
+		return r.cert, r.caPool
+	}
+	err = r.load()
+	if err != nil {
+		logger.Logger.Errorw("重新加载tls证书错误，继续使用已加载证书", "err", err, "cert", r.certFile, "ca", r.caFile)
+	} else {
+		logger.Logger.Infow("重新加载tls证书", "cert", r.certFile, "ca", r.caFile)
+	}
+	return r.cert, r.caPool
+}
+
+// ServerConfig 服务端tls配置，设置了ca证书时要求并验证客户端证书
+func (r *TLSReloader) ServerConfig() *tls.Config {
+	cert, caPool := r.current()
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if cert != nil {
+		cfg.Certificates = []tls.Certificate{*cert}
+	}
+	if caPool != nil {
+		cfg.ClientCAs = caPool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg
+}
+
+// ServerCredentials grpc服务端证书，每次握手使用最新证书
+func (r *TLSReloader) ServerCredentials() credentials.TransportCredentials {
+	return &serverCredentials{reloader: r}
+}
+
+// 服务端热加载证书
+type serverCredentials struct {
+	reloader *TLSReloader
+}
+
+// ClientHandshake 服务端证书不支持客户端握手
+func (c *serverCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("server credentials can not be used for client handshake")
+}
+
+// ServerHandshake 使用最新证书握手
+func (c *serverCredentials) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return credentials.NewTLS(c.reloader.ServerConfig()).ServerHandshake(rawConn)
+}
+
+// Info 协议信息
+func (c *serverCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{
+		SecurityProtocol: "tls",
+		SecurityVersion:  "1.2",
+	}
+}
+
+// Clone 复制
+func (c *serverCredentials) Clone() credentials.TransportCredentials {
+	return &serverCredentials{reloader: c.reloader}
+}
+
+// OverrideServerName 服务端无需设置
+func (c *serverCredentials) OverrideServerName(serverName string) error {
+	return nil
+}
+
+// ClientConfig 客户端tls配置，未设置ca证书时使用系统根证书
+func (r *TLSReloader) ClientConfig(serverName string, insecureSkipVerify bool) *tls.Config {
+	cert, caPool := r.current()
+	cfg := &tls.Config{
+		ServerName:         serverName,
+		RootCAs:            caPool,
+		InsecureSkipVerify: insecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if cert != nil {
+		cfg.Certificates = []tls.Certificate{*cert}
+	}
+	return cfg
+}
+
+// ClientCredentials grpc客户端证书，每次握手使用最新证书
+// serverName 为空时按连接的 authority(服务名) 验证，不是节点地址，服务端证书需要包含服务名的 SAN
+func (r *TLSReloader) ClientCredentials(serverName string, insecureSkipVerify bool) credentials.TransportCredentials {
+	return &clientCredentials{
+		reloader:           r,
+		serverName:         serverName,
+		insecureSkipVerify: insecureSkipVerify,
+	}
+}
+
+// 客户端热加载证书
+type clientCredentials struct {
+	reloader           *TLSReloader
+	serverName         string // 验证服务端证书使用的域名，为空时使用连接的 authority 即服务名
+	insecureSkipVerify bool   // 是否跳过服务端证书验证
+}
+
+// ClientHandshake 使用最新证书握手
+func (c *clientCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return credentials.NewTLS(c.reloader.ClientConfig(c.serverName, c.insecureSkipVerify)).ClientHandshake(ctx, authority, rawConn)
+}
+
+// ServerHandshake 客户端证书不支持服务端握手
+func (c *clientCredentials) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("client credentials can not be used for server handshake")
+}
+
+// Info 协议信息
+func (c *clientCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{
+		SecurityProtocol: "tls",
+		SecurityVersion:  "1.2",
+		ServerName:       c.serverName,
+	}
+}
+
+// Clone 复制
+func (c *clientCredentials) Clone() credentials.TransportCredentials {
+	return &clientCredentials{
+		reloader:           c.reloader,
+		serverName:         c.serverName,
+		insecureSkipVerify: c.insecureSkipVerify,
+	}
+}
+
+// OverrideServerName 设置验证服务端证书使用的域名
+func (c *clientCredentials) OverrideServerName(serverName string) error {
+	c.serverName = serverName
+	return nil
+}
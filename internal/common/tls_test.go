@@ -0,0 +1,226 @@
+package common
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	// 测试证书域名
+	testServerName = "microkit.test"
+)
+
+// 测试证书
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// 创建证书，parent 为nil时创建自签名ca证书
+func newTestCert(t *testing.T, cn string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{testServerName},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tpl, key
+	if parent == nil {
+		tpl.IsCA = true
+		tpl.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+// 写入证书和私钥文件，修改时间设置为 modTime
+func (c *testCert) write(t *testing.T, certFile, keyFile string, modTime time.Time) {
+	t.Helper()
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+	writeFile(t, certFile, certPEM, modTime)
+	if keyFile == "" {
+		return
+	}
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), modTime)
+}
+
+func writeFile(t *testing.T, name string, data []byte, modTime time.Time) {
+	t.Helper()
+	if err := ioutil.WriteFile(name, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 当前服务端证书的 CommonName
+func serverCN(t *testing.T, r *TLSReloader) string {
+	t.Helper()
+	certs := r.ServerConfig().Certificates
+	if len(certs) != 1 {
+		t.Fatalf("服务端证书数量 = %d, want 1", len(certs))
+	}
+	cert, err := x509.ParseCertificate(certs[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Subject.CommonName
+}
+
+// 下次获取证书时检查文件变化
+func (r *TLSReloader) expireCheck() {
+	r.mu.Lock()
+	r.lastCheck = time.Now().Add(-tlsReloadInterval)
+	r.mu.Unlock()
+}
+
+func TestTLSReloaderReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "microkit-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	ca := newTestCert(t, "ca", nil)
+	now := time.Now()
+	newTestCert(t, "first", ca).write(t, certFile, keyFile, now.Add(-time.Minute))
+
+	r, err := NewTLSReloader(certFile, keyFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cn := serverCN(t, r); cn != "first" {
+		t.Fatalf("证书 = %s, want first", cn)
+	}
+
+	// 检查间隔内不重新加载
+	newTestCert(t, "second", ca).write(t, certFile, keyFile, now)
+	if cn := serverCN(t, r); cn != "first" {
+		t.Errorf("检查间隔内证书 = %s, want first", cn)
+	}
+	r.expireCheck()
+	if cn := serverCN(t, r); cn != "second" {
+		t.Errorf("文件变化后证书 = %s, want second", cn)
+	}
+
+	// 加载失败继续使用旧证书
+	writeFile(t, certFile, []byte("invalid"), now.Add(time.Minute))
+	r.expireCheck()
+	if cn := serverCN(t, r); cn != "second" {
+		t.Errorf("加载失败后证书 = %s, want second", cn)
+	}
+}
+
+func TestNewTLSReloaderError(t *testing.T) {
+	if _, err := NewTLSReloader("not-exist.pem", "not-exist.key", ""); err == nil {
+		t.Error("NewTLSReloader() 证书文件不存在时未返回错误")
+	}
+}
+
+func TestMutualTLSHandshake(t *testing.T) {
+	dir, err := ioutil.TempDir("", "microkit-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := func(name string) string { return filepath.Join(dir, name) }
+	now := time.Now()
+	ca := newTestCert(t, "ca", nil)
+	ca.write(t, file("ca.pem"), "", now)
+	newTestCert(t, "server", ca).write(t, file("server.pem"), file("server.key"), now)
+	newTestCert(t, "client", ca).write(t, file("client.pem"), file("client.key"), now)
+	// 其它ca签发的客户端证书
+	newTestCert(t, "other", newTestCert(t, "other-ca", nil)).write(t, file("other.pem"), file("other.key"), now)
+
+	server, err := NewTLSReloader(file("server.pem"), file("server.key"), file("ca.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		cert    string
+		wantErr bool
+	}{
+		{name: "客户端证书由ca签发", cert: "client"},
+		{name: "客户端证书由其它ca签发", cert: "other", wantErr: true},
+		{name: "未设置客户端证书", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certFile, keyFile := "", ""
+			if tt.cert != "" {
+				certFile, keyFile = file(tt.cert+".pem"), file(tt.cert+".key")
+			}
+			client, err := NewTLSReloader(certFile, keyFile, file("ca.pem"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer lis.Close()
+			serverErr := make(chan error, 1)
+			go func() {
+				sconn, err := lis.Accept()
+				if err != nil {
+					serverErr <- err
+					return
+				}
+				defer sconn.Close()
+				_, _, err = server.ServerCredentials().ServerHandshake(sconn)
+				serverErr <- err
+			}()
+			cconn, err := net.Dial("tcp", lis.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cconn.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			// 未设置 serverName 时按 authority 验证服务端证书
+			_, _, err = client.ClientCredentials("", false).ClientHandshake(ctx, testServerName, cconn)
+			// TLS 1.3 客户端握手完成后服务端才验证客户端证书
+			if e := <-serverErr; err == nil {
+				err = e
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("握手 error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
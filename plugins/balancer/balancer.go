@@ -0,0 +1,118 @@
+package balancer
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/micro-kit/microkit/plugins/register"
+	grpcBalancer "google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+/*
+ 客户端负载均衡器公共方法
+ 各负载均衡器在所在包的 init 中注册到grpc，客户端通过 client.Balancer 按名称选择
+*/
+
+// NewBuilder 创建负载均衡器，每个连接调用 newPickerBuilder 创建独立的 PickerBuilder
+// 节点统计信息(进行中请求数、延迟等)保存在 PickerBuilder 中，节点变化重新创建 picker 时不会丢失
+// 同一次调用的多个副本选择不同节点，参考 PickedNodes
+func NewBuilder(name string, newPickerBuilder func() base.V2PickerBuilder) grpcBalancer.Builder {
+	return &builder{
+		name:             name,
+		newPickerBuilder: newPickerBuilder,
+	}
+}
+
+// 每个连接独立的负载均衡器
+type builder struct {
+	name             string
+	newPickerBuilder func() base.V2PickerBuilder
+}
+
+// Build 使用新的 PickerBuilder 创建负载均衡器
+func (b *builder) Build(cc grpcBalancer.ClientConn, opts grpcBalancer.BuildOptions) grpcBalancer.Balancer {
+	return base.NewBalancerBuilderV2(b.name, DistinctPickerBuilder(b.newPickerBuilder()), base.Config{HealthCheck: true}).Build(cc, opts)
+}
+
+// Name 负载均衡器名称
+func (b *builder) Name() string {
+	return b.name
+}
+
+// NodeID 获取地址对应节点的id，未携带节点信息时使用地址
+// 节点统计按节点id保存，地址重新创建或连接重建时统计不会丢失
+func NodeID(addr resolver.Address) string {
+	if n, ok := register.NodeFromAddress(addr); ok && n.Id != "" {
+		return n.Id
+	}
+	return addr.Addr
+}
+
+// Weight 获取地址对应节点的权重，未设置或无效时返回1
+func Weight(addr resolver.Address) int {
+	n, ok := register.NodeFromAddress(addr)
+	if !ok || n.Metadata == nil {
+		return 1
+	}
+	w, err := strconv.Atoi(n.Metadata[register.MetadataWeight])
+	if err != nil || w <= 0 {
+		return 1
+	}
+	return w
+}
+
+// WeightedRoundRobin 平滑加权轮询，每次选择时每个节点当前权重增加其权重，选择当前权重最大的节点并减去全部权重之和
+// 权重高的节点请求不会集中在一起，并发安全
+type WeightedRoundRobin struct {
+	mu    sync.Mutex
+	items []*weightedItem
+	total int // 全部节点权重之和
+}
+
+// 加权轮询节点
+type weightedItem struct {
+	sc      grpcBalancer.SubConn
+	weight  int // 权重
+	current int // 当前权重
+}
+
+// Add 添加节点，权重小于1时按1处理
+func (rr *WeightedRoundRobin) Add(sc grpcBalancer.SubConn, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.items = append(rr.items, &weightedItem{
+		sc:     sc,
+		weight: weight,
+	})
+	rr.total += weight
+}
+
+// Len 节点数
+func (rr *WeightedRoundRobin) Len() int {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	return len(rr.items)
+}
+
+// Next 选择当前权重最大的节点，没有节点时返回nil
+func (rr *WeightedRoundRobin) Next() grpcBalancer.SubConn {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	var best *weightedItem
+	for _, it := range rr.items {
+		it.current += it.weight
+		if best == nil || it.current > best.current {
+			best = it
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	best.current -= rr.total
+	return best.sc
+}
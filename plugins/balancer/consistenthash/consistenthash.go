@@ -0,0 +1,217 @@
+package consistenthash
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	kitBalancer "github.com/micro-kit/microkit/plugins/balancer"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/metadata"
+)
+
+/*
+ 有界负载一致性哈希负载均衡器
+ 哈希key从 WithHashKey 设置的上下文值或请求metadata读取，相同key的请求发送到同一节点
+ 节点按节点id放到哈希环上，节点变化时只有该节点上的key重新分配
+ 节点进行中请求数达到 平均值*负载上限系数 时顺延到哈希环上的下一个节点，避免热点key压垮单个节点
+ 未设置哈希key的请求随机选择节点
+*/
+
+const (
+	// Name 负载均衡器名称，哈希key读取 DefaultMetadataKey
+	Name = "consistent_hash"
+)
+
+func init() {
+	balancer.Register(NewBuilder(Name))
+}
+
+// 上下文哈希key
+type hashKey struct{}
+
+// WithHashKey 设置请求的哈希key，优先于请求metadata
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKey{}, key)
+}
+
+// NewBuilder 创建一致性哈希负载均衡器，可使用不同名称和配置注册多个
+func NewBuilder(name string, opts ...Option) balancer.Builder {
+	o := new(Options)
+	for _, opt := range opts {
+		opt(o)
+	}
+	// 默认值
+	if o.MetadataKey == "" {
+		o.MetadataKey = DefaultMetadataKey
+	}
+	if o.Replicas <= 0 {
+		o.Replicas = defaultReplicas
+	}
+	if o.LoadFactor <= 1 {
+		o.LoadFactor = defaultLoadFactor
+	}
+	return kitBalancer.NewBuilder(name, func() base.V2PickerBuilder {
+		return &pickerBuilder{
+			opts:     o,
+			inflight: make(map[string]*int64),
+			total:    new(int64),
+		}
+	})
+}
+
+// 创建 picker，保存节点进行中请求数
+type pickerBuilder struct {
+	opts     *Options
+	mu       sync.Mutex
+	inflight map[string]*int64 // 节点id -> 进行中请求数
+	total    *int64            // 全部节点进行中请求数
+}
+
+// Build 根据可用节点创建哈希环，删除不可用节点的统计
+func (pb *pickerBuilder) Build(info base.PickerBuildInfo) balancer.V2Picker {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	ready := make(map[string]struct{}, len(info.ReadySCs))
+	for _, sci := range info.ReadySCs {
+		ready[kitBalancer.NodeID(sci.Address)] = struct{}{}
+	}
+	for id := range pb.inflight {
+		if _, ok := ready[id]; !ok {
+			delete(pb.inflight, id)
+		}
+	}
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPickerV2(balancer.ErrNoSubConnAvailable)
+	}
+	p := &picker{
+		opts:  pb.opts,
+		total: pb.total,
+		items: make([]*item, 0, len(info.ReadySCs)),
+		ring:  make([]point, 0, len(info.ReadySCs)*pb.opts.Replicas),
+	}
+	for sc, sci := range info.ReadySCs {
+		// 使用节点id计算虚拟节点位置，节点地址变化不影响key分配
+		id := kitBalancer.NodeID(sci.Address)
+		n, ok := pb.inflight[id]
+		if !ok {
+			n = new(int64)
+			pb.inflight[id] = n
+		}
+		it := &item{
+			sc:       sc,
+			inflight: n,
+		}
+		p.items = append(p.items, it)
+		for i := 0; i < pb.opts.Replicas; i++ {
+			p.ring = append(p.ring, point{
+				hash: hash(id + "#" + strconv.Itoa(i)),
+				item: it,
+			})
+		}
+	}
+	sort.Slice(p.ring, func(i, j int) bool {
+		return p.ring[i].hash < p.ring[j].hash
+	})
+	return p
+}
+
+// 节点
+type item struct {
+	sc       balancer.SubConn
+	inflight *int64 // 进行中请求数
+}
+
+// 哈希环上的虚拟节点
+type point struct {
+	hash uint64
+	item *item
+}
+
+// 一致性哈希选择节点
+type picker struct {
+	opts  *Options
+	items []*item
+	ring  []point // 按哈希值排序
+	total *int64  // 全部节点进行中请求数
+}
+
+// Pick 从key在哈希环上的位置顺时针查找第一个未超过负载上限的节点
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	var it *item
+	key, ok := p.hashKey(info.Ctx)
+	if !ok {
+		it = p.items[rand.Intn(len(p.items))]
+	} else {
+		it = p.lookup(hash(key))
+	}
+	atomic.AddInt64(it.inflight, 1)
+	atomic.AddInt64(p.total, 1)
+	return balancer.PickResult{
+		SubConn: it.sc,
+		Done: func(balancer.DoneInfo) {
+			atomic.AddInt64(it.inflight, -1)
+			atomic.AddInt64(p.total, -1)
+		},
+	}, nil
+}
+
+// 获取请求的哈希key
+func (p *picker) hashKey(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	if key, ok := ctx.Value(hashKey{}).(string); ok && key != "" {
+		return key, true
+	}
+	return metadataValue(ctx, p.opts.MetadataKey)
+}
+
+// 读取请求metadata的第一个值
+func metadataValue(ctx context.Context, key string) (string, bool) {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	vals := md.Get(key)
+	if len(vals) == 0 || vals[0] == "" {
+		return "", false
+	}
+	return vals[0], true
+}
+
+// 查找节点，负载上限 ceil(平均进行中请求数(包含本次请求)*负载上限系数)
+func (p *picker) lookup(h uint64) *item {
+	total := atomic.LoadInt64(p.total) + 1
+	limit := int64(math.Ceil(float64(total) * p.opts.LoadFactor / float64(len(p.items))))
+	start := sort.Search(len(p.ring), func(i int) bool {
+		return p.ring[i].hash >= h
+	})
+	for i := 0; i < len(p.ring); i++ {
+		pt := p.ring[(start+i)%len(p.ring)]
+		if atomic.LoadInt64(pt.item.inflight) < limit {
+			return pt.item
+		}
+	}
+	// 并发请求计数变化时可能全部达到上限，使用key对应的节点
+	return p.ring[start%len(p.ring)].item
+}
+
+// 64位哈希，fnv结果再混合一次使虚拟节点分布更均匀
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
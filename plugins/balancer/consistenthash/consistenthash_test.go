@@ -0,0 +1,157 @@
+package consistenthash
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/micro-kit/microkit/plugins/balancer/internal/balancertest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/metadata"
+)
+
+func newPickerBuilder(loadFactor float64) *pickerBuilder {
+	return &pickerBuilder{
+		opts: &Options{
+			MetadataKey: DefaultMetadataKey,
+			Replicas:    defaultReplicas,
+			LoadFactor:  loadFactor,
+		},
+		inflight: make(map[string]*int64),
+		total:    new(int64),
+	}
+}
+
+func TestPickSameKey(t *testing.T) {
+	p := newPickerBuilder(defaultLoadFactor).Build(balancertest.BuildInfo(balancertest.Nodes("a", "b", "c", "d")...))
+	tests := []struct {
+		name string
+		ctx  func(key string) context.Context
+	}{
+		{
+			name: "请求metadata",
+			ctx: func(key string) context.Context {
+				return metadata.AppendToOutgoingContext(context.Background(), DefaultMetadataKey, key)
+			},
+		},
+		{
+			name: "上下文哈希key",
+			ctx: func(key string) context.Context {
+				return WithHashKey(context.Background(), key)
+			},
+		},
+		{
+			name: "上下文哈希key优先于请求metadata",
+			ctx: func(key string) context.Context {
+				ctx := metadata.AppendToOutgoingContext(context.Background(), DefaultMetadataKey, "other")
+				return WithHashKey(ctx, key)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				key := fmt.Sprint("user-", i)
+				want := balancertest.Pick(t, p, balancer.PickInfo{Ctx: WithHashKey(context.Background(), key)})
+				for j := 0; j < 5; j++ {
+					if got := balancertest.Pick(t, p, balancer.PickInfo{Ctx: tt.ctx(key)}); got != want {
+						t.Fatalf("key %s 选择节点 %s, want %s", key, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBoundedLoad(t *testing.T) {
+	ids := []string{"a", "b", "c", "d"}
+	tests := []struct {
+		name       string
+		loadFactor float64
+		inflight   int
+	}{
+		{name: "负载上限1.25", loadFactor: 1.25, inflight: 40},
+		{name: "负载上限1.5", loadFactor: 1.5, inflight: 40},
+		{name: "负载上限2", loadFactor: 2, inflight: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPickerBuilder(tt.loadFactor).Build(balancertest.BuildInfo(balancertest.Nodes(ids...)...))
+			ctx := WithHashKey(context.Background(), "hot-key")
+			got := make(map[string]int)
+			for i := 0; i < tt.inflight; i++ {
+				res, err := p.Pick(balancer.PickInfo{Ctx: ctx})
+				if err != nil {
+					t.Fatalf("Pick() error = %v", err)
+				}
+				got[balancertest.ID(res)]++
+			}
+			limit := int(math.Ceil(float64(tt.inflight) * tt.loadFactor / float64(len(ids))))
+			for id, n := range got {
+				if n > limit {
+					t.Errorf("节点 %s 进行中请求 %d 超过上限 %d, got %v", id, n, limit, got)
+				}
+			}
+			if len(got) < 2 {
+				t.Errorf("热点key没有顺延到其它节点, got %v", got)
+			}
+		})
+	}
+}
+
+func TestMinimalRemap(t *testing.T) {
+	pb := newPickerBuilder(defaultLoadFactor)
+	before := make(map[string]string)
+	p := pb.Build(balancertest.BuildInfo(balancertest.Nodes("a", "b", "c", "d")...))
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprint("user-", i)
+		before[key] = balancertest.Pick(t, p, balancer.PickInfo{Ctx: WithHashKey(context.Background(), key)})
+	}
+	// 删除节点 d，其它节点重新推送地址
+	p = pb.Build(balancertest.BuildInfo(balancertest.Nodes("a", "b", "c")...))
+	for key, id := range before {
+		got := balancertest.Pick(t, p, balancer.PickInfo{Ctx: WithHashKey(context.Background(), key)})
+		if id != "d" && got != id {
+			t.Errorf("key %s 从节点 %s 重新分配到 %s", key, id, got)
+		}
+	}
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{
+			name: "读取指定metadata",
+			ctx:  metadata.AppendToOutgoingContext(context.Background(), "x-user", "u1"),
+			want: "u1",
+		},
+		{
+			name: "上下文哈希key优先",
+			ctx:  WithHashKey(metadata.AppendToOutgoingContext(context.Background(), "x-user", "u1"), "u2"),
+			want: "u2",
+		},
+		{
+			name: "未设置metadata",
+			ctx:  context.Background(),
+			want: "",
+		},
+	}
+	interceptor := UnaryClientInterceptor("x-user")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			interceptor(tt.ctx, "/svc/Method", nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				got, _ = ctx.Value(hashKey{}).(string)
+				return nil
+			})
+			if got != tt.want {
+				t.Errorf("哈希key = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
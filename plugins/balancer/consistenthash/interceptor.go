@@ -0,0 +1,37 @@
+package consistenthash
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+/*
+ 按客户端设置的metadata key读取哈希key
+ 负载均衡器注册时只能使用一个 MetadataKey，不同客户端使用不同key时通过拦截器设置 WithHashKey
+*/
+
+// UnaryClientInterceptor 读取请求metadata key 的值作为哈希key，已通过 WithHashKey 设置时不覆盖
+func UnaryClientInterceptor(metadataKey string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(withMetadataHashKey(ctx, metadataKey), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor 读取请求metadata key 的值作为哈希key，已通过 WithHashKey 设置时不覆盖
+func StreamClientInterceptor(metadataKey string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(withMetadataHashKey(ctx, metadataKey), desc, cc, method, opts...)
+	}
+}
+
+// 请求metadata存在该key时设置哈希key
+func withMetadataHashKey(ctx context.Context, metadataKey string) context.Context {
+	if key, ok := ctx.Value(hashKey{}).(string); ok && key != "" {
+		return ctx
+	}
+	if key, ok := metadataValue(ctx, metadataKey); ok {
+		return WithHashKey(ctx, key)
+	}
+	return ctx
+}
@@ -0,0 +1,43 @@
+package consistenthash
+
+/* 一致性哈希负载均衡器配置 */
+
+const (
+	// DefaultMetadataKey 默认读取哈希key的请求metadata
+	DefaultMetadataKey = "x-hash-key"
+	// 默认每个节点的虚拟节点数
+	defaultReplicas = 100
+	// 默认负载上限系数，节点进行中请求数不超过平均值的1.25倍
+	defaultLoadFactor = 1.25
+)
+
+// Option 实例值设置
+type Option func(*Options)
+
+// Options 一致性哈希负载均衡器参数
+type Options struct {
+	MetadataKey string  // 读取哈希key的请求metadata
+	Replicas    int     // 每个节点的虚拟节点数
+	LoadFactor  float64 // 负载上限系数，必须大于1
+}
+
+// MetadataKey 读取哈希key的请求metadata，WithHashKey 设置的上下文值优先
+func MetadataKey(key string) Option {
+	return func(o *Options) {
+		o.MetadataKey = key
+	}
+}
+
+// Replicas 每个节点的虚拟节点数，越多分布越均匀
+func Replicas(replicas int) Option {
+	return func(o *Options) {
+		o.Replicas = replicas
+	}
+}
+
+// LoadFactor 负载上限系数，节点进行中请求数达到 平均值*系数 时顺延到哈希环上的下一个节点
+func LoadFactor(loadFactor float64) Option {
+	return func(o *Options) {
+		o.LoadFactor = loadFactor
+	}
+}
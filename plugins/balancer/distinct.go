@@ -0,0 +1,121 @@
+package balancer
+
+import (
+	"context"
+	"sync"
+
+	grpcBalancer "google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+/*
+ 同一次调用的多个副本选择不同节点
+ 对冲请求等场景下多个副本共享 PickedNodes，负载均衡器选中已被其它副本选择的节点时重新选择
+ 可用节点都已被选择时使用最后一次选择的节点
+*/
+
+var (
+	// 放弃本次选择时通知负载均衡器，按调用方取消处理，不计入节点错误
+	errPickSkipped = status.Error(codes.Canceled, "节点已被同一调用的其它副本选择")
+)
+
+// 上下文已选择节点
+type pickedNodesKey struct{}
+
+// PickedNodes 同一次调用的多个副本已选择的节点id
+type PickedNodes struct {
+	mu  sync.Mutex
+	ids map[string]struct{}
+}
+
+// NewPickedNodes 创建已选择节点记录
+func NewPickedNodes() *PickedNodes {
+	return &PickedNodes{
+		ids: make(map[string]struct{}),
+	}
+}
+
+// WithPickedNodes 设置调用副本共享的已选择节点记录
+func WithPickedNodes(ctx context.Context, pn *PickedNodes) context.Context {
+	return context.WithValue(ctx, pickedNodesKey{}, pn)
+}
+
+// 获取上下文中的已选择节点记录
+func pickedNodesFromContext(ctx context.Context) *PickedNodes {
+	if ctx == nil {
+		return nil
+	}
+	pn, _ := ctx.Value(pickedNodesKey{}).(*PickedNodes)
+	return pn
+}
+
+// Len 已选择节点数
+func (pn *PickedNodes) Len() int {
+	pn.mu.Lock()
+	defer pn.mu.Unlock()
+	return len(pn.ids)
+}
+
+// 记录节点，已被选择时返回false
+func (pn *PickedNodes) add(id string, force bool) bool {
+	pn.mu.Lock()
+	defer pn.mu.Unlock()
+	if _, ok := pn.ids[id]; ok && !force {
+		return false
+	}
+	pn.ids[id] = struct{}{}
+	return true
+}
+
+// DistinctPickerBuilder 包装 PickerBuilder，上下文设置了 PickedNodes 时避开已被选择的节点
+func DistinctPickerBuilder(pb base.V2PickerBuilder) base.V2PickerBuilder {
+	return &distinctPickerBuilder{
+		V2PickerBuilder: pb,
+	}
+}
+
+// 包装 PickerBuilder
+type distinctPickerBuilder struct {
+	base.V2PickerBuilder
+}
+
+// Build 记录可用节点id
+func (pb *distinctPickerBuilder) Build(info base.PickerBuildInfo) grpcBalancer.V2Picker {
+	p := &distinctPicker{
+		V2Picker: pb.V2PickerBuilder.Build(info),
+		nodes:    make(map[grpcBalancer.SubConn]string, len(info.ReadySCs)),
+	}
+	for sc, sci := range info.ReadySCs {
+		p.nodes[sc] = NodeID(sci.Address)
+	}
+	return p
+}
+
+// 选择未被其它副本选择的节点
+type distinctPicker struct {
+	grpcBalancer.V2Picker
+	nodes map[grpcBalancer.SubConn]string // 可用节点 -> 节点id
+}
+
+// Pick 选中已被选择的节点时重新选择，最多尝试可用节点数的两倍次
+func (p *distinctPicker) Pick(info grpcBalancer.PickInfo) (grpcBalancer.PickResult, error) {
+	pn := pickedNodesFromContext(info.Ctx)
+	if pn == nil {
+		return p.V2Picker.Pick(info)
+	}
+	for i := 1; ; i++ {
+		res, err := p.V2Picker.Pick(info)
+		if err != nil {
+			return res, err
+		}
+		if pn.add(p.nodes[res.SubConn], i >= 2*len(p.nodes)) {
+			return res, nil
+		}
+		// 放弃本次选择
+		if res.Done != nil {
+			res.Done(grpcBalancer.DoneInfo{Err: errPickSkipped})
+		}
+	}
+}
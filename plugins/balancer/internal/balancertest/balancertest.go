@@ -0,0 +1,96 @@
+package balancertest
+
+import (
+	"testing"
+
+	"github.com/micro-kit/microkit/plugins/register"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+/*
+ 负载均衡器测试公共部分
+ 只用于各负载均衡器的测试，节点地址与节点id相同
+*/
+
+// SubConn 测试用节点连接
+type SubConn struct {
+	ID string
+}
+
+// UpdateAddresses 什么也不做
+func (sc *SubConn) UpdateAddresses([]resolver.Address) {}
+
+// Connect 什么也不做
+func (sc *SubConn) Connect() {}
+
+// Node 创建测试节点，metadata 按 key, value 依次传入，value 为空时不设置
+func Node(id string, kv ...string) *register.Node {
+	n := &register.Node{Id: id, Address: id}
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] == "" {
+			continue
+		}
+		if n.Metadata == nil {
+			n.Metadata = make(map[string]string)
+		}
+		n.Metadata[kv[i]] = kv[i+1]
+	}
+	return n
+}
+
+// Nodes 按id创建未设置 metadata 的测试节点
+func Nodes(ids ...string) []*register.Node {
+	nodes := make([]*register.Node, 0, len(ids))
+	for _, id := range ids {
+		nodes = append(nodes, Node(id))
+	}
+	return nodes
+}
+
+// WeightedNodes 按 节点id -> 权重 创建测试节点，权重为空时不设置
+func WeightedNodes(weights map[string]string) []*register.Node {
+	nodes := make([]*register.Node, 0, len(weights))
+	for id, w := range weights {
+		nodes = append(nodes, Node(id, register.MetadataWeight, w))
+	}
+	return nodes
+}
+
+// BuildInfo 每次调用为节点创建新的连接和地址，模拟节点地址重新推送
+func BuildInfo(nodes ...*register.Node) base.PickerBuildInfo {
+	info := base.PickerBuildInfo{ReadySCs: make(map[balancer.SubConn]base.SubConnInfo)}
+	for _, n := range nodes {
+		info.ReadySCs[&SubConn{ID: n.Id}] = base.SubConnInfo{Address: register.NewAddress(n)}
+	}
+	return info
+}
+
+// ID 选中节点的id
+func ID(res balancer.PickResult) string {
+	return res.SubConn.(*SubConn).ID
+}
+
+// Pick 选择节点并立即结束请求，返回节点id
+func Pick(t testing.TB, p balancer.V2Picker, info balancer.PickInfo) string {
+	t.Helper()
+	res, err := p.Pick(info)
+	if err != nil {
+		t.Fatalf("Pick() error = %v", err)
+	}
+	if res.Done != nil {
+		res.Done(balancer.DoneInfo{})
+	}
+	return ID(res)
+}
+
+// Count 选择 n 次节点并立即结束请求，返回 节点id -> 选中次数
+func Count(t testing.TB, p balancer.V2Picker, info balancer.PickInfo, n int) map[string]int {
+	t.Helper()
+	got := make(map[string]int)
+	for i := 0; i < n; i++ {
+		got[Pick(t, p, info)]++
+	}
+	return got
+}
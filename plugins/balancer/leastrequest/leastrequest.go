@@ -0,0 +1,104 @@
+package leastrequest
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	kitBalancer "github.com/micro-kit/microkit/plugins/balancer"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+/*
+ 最少进行中请求负载均衡器
+ 选择 进行中请求数/权重 最小的节点，权重从服务注册附加信息 weight 读取
+*/
+
+const (
+	// Name 负载均衡器名称
+	Name = "least_request"
+)
+
+func init() {
+	balancer.Register(kitBalancer.NewBuilder(Name, func() base.V2PickerBuilder {
+		return &pickerBuilder{
+			inflight: make(map[string]*int64),
+		}
+	}))
+}
+
+// 创建 picker，保存节点进行中请求数
+type pickerBuilder struct {
+	mu       sync.Mutex
+	inflight map[string]*int64 // 节点id -> 进行中请求数
+}
+
+// Build 根据可用节点创建 picker，删除不可用节点的统计
+func (pb *pickerBuilder) Build(info base.PickerBuildInfo) balancer.V2Picker {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	ready := make(map[string]struct{}, len(info.ReadySCs))
+	for _, sci := range info.ReadySCs {
+		ready[kitBalancer.NodeID(sci.Address)] = struct{}{}
+	}
+	for id := range pb.inflight {
+		if _, ok := ready[id]; !ok {
+			delete(pb.inflight, id)
+		}
+	}
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPickerV2(balancer.ErrNoSubConnAvailable)
+	}
+	p := &picker{
+		items: make([]*item, 0, len(info.ReadySCs)),
+	}
+	for sc, sci := range info.ReadySCs {
+		id := kitBalancer.NodeID(sci.Address)
+		n, ok := pb.inflight[id]
+		if !ok {
+			n = new(int64)
+			pb.inflight[id] = n
+		}
+		p.items = append(p.items, &item{
+			sc:       sc,
+			weight:   float64(kitBalancer.Weight(sci.Address)),
+			inflight: n,
+		})
+	}
+	return p
+}
+
+// 节点
+type item struct {
+	sc       balancer.SubConn
+	weight   float64
+	inflight *int64 // 进行中请求数
+}
+
+// 选择进行中请求最少的节点
+type picker struct {
+	items []*item
+}
+
+// Pick 从随机位置开始比较，进行中请求数相同时请求分散到不同节点
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	var best *item
+	var bestScore float64
+	start := rand.Intn(len(p.items))
+	for i := range p.items {
+		it := p.items[(start+i)%len(p.items)]
+		score := float64(atomic.LoadInt64(it.inflight)+1) / it.weight
+		if best == nil || score < bestScore {
+			best = it
+			bestScore = score
+		}
+	}
+	atomic.AddInt64(best.inflight, 1)
+	return balancer.PickResult{
+		SubConn: best.sc,
+		Done: func(balancer.DoneInfo) {
+			atomic.AddInt64(best.inflight, -1)
+		},
+	}, nil
+}
@@ -0,0 +1,89 @@
+package leastrequest
+
+import (
+	"testing"
+
+	"github.com/micro-kit/microkit/plugins/balancer/internal/balancertest"
+	"google.golang.org/grpc/balancer"
+)
+
+func newPickerBuilder() *pickerBuilder {
+	return &pickerBuilder{inflight: make(map[string]*int64)}
+}
+
+func TestPick(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[string]string
+		picks   int            // 不结束的请求数
+		want    map[string]int // 进行中请求在节点间的分布
+	}{
+		{
+			name:    "进行中请求分散到不同节点",
+			weights: map[string]string{"a": "1", "b": "1", "c": "1"},
+			picks:   6,
+			want:    map[string]int{"a": 2, "b": 2, "c": 2},
+		},
+		{
+			name:    "按权重分配进行中请求",
+			weights: map[string]string{"a": "1", "b": "3"},
+			picks:   4,
+			want:    map[string]int{"a": 1, "b": 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPickerBuilder().Build(balancertest.BuildInfo(balancertest.WeightedNodes(tt.weights)...))
+			got := make(map[string]int)
+			for i := 0; i < tt.picks; i++ {
+				res, err := p.Pick(balancer.PickInfo{})
+				if err != nil {
+					t.Fatalf("Pick() error = %v", err)
+				}
+				got[balancertest.ID(res)]++
+			}
+			for id, n := range tt.want {
+				if got[id] != n {
+					t.Errorf("节点 %s 进行中请求 %d, want %d, got %v", id, got[id], n, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPickDone(t *testing.T) {
+	p := newPickerBuilder().Build(balancertest.BuildInfo(balancertest.WeightedNodes(map[string]string{"a": "1", "b": "1"})...))
+	first, _ := p.Pick(balancer.PickInfo{})
+	second, _ := p.Pick(balancer.PickInfo{})
+	if first.SubConn == second.SubConn {
+		t.Fatalf("两个进行中请求选择了同一节点")
+	}
+	// 请求结束后该节点进行中请求最少
+	first.Done(balancer.DoneInfo{})
+	res, _ := p.Pick(balancer.PickInfo{})
+	if res.SubConn != first.SubConn {
+		t.Errorf("Pick() = %v, want %v", res.SubConn, first.SubConn)
+	}
+}
+
+func pick(p balancer.V2Picker) balancer.PickResult {
+	res, _ := p.Pick(balancer.PickInfo{})
+	return res
+}
+
+func TestStatsKeptAcrossRebuild(t *testing.T) {
+	pb := newPickerBuilder()
+	p := pb.Build(balancertest.BuildInfo(balancertest.WeightedNodes(map[string]string{"a": "1", "b": "1"})...))
+	// 两个请求分别选择两个节点，节点 a 保留一个进行中请求
+	for _, res := range []balancer.PickResult{pick(p), pick(p)} {
+		if balancertest.ID(res) == "b" {
+			res.Done(balancer.DoneInfo{})
+		}
+	}
+	// 节点地址重新推送，连接重建后按节点id保留进行中请求数
+	p = pb.Build(balancertest.BuildInfo(balancertest.WeightedNodes(map[string]string{"a": "1", "b": "1"})...))
+	res, _ := p.Pick(balancer.PickInfo{})
+	if id := balancertest.ID(res); id != "b" {
+		t.Errorf("Pick() = %s, want b", id)
+	}
+}
@@ -0,0 +1,203 @@
+package locality
+
+import (
+	"sync"
+
+	"github.com/micro-kit/microkit/internal/common"
+	kitBalancer "github.com/micro-kit/microkit/plugins/balancer"
+	"github.com/micro-kit/microkit/plugins/register"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+/*
+ 就近调用负载均衡器
+ 节点所在可用区和地域从服务注册附加信息 zone region 读取，调用范围依次为 同可用区 同地域 全部节点
+ 某个范围内 可用节点权重/全部节点权重 不低于故障转移阈值时只调用该范围内的可用节点，否则扩大范围
+ 范围内按节点权重平滑加权轮询
+*/
+
+const (
+	// Name 负载均衡器名称，客户端位置在创建连接时从环境变量获取
+	Name = "locality"
+)
+
+// 调用范围
+const (
+	scopeZone   = "zone"
+	scopeRegion = "region"
+	scopeAll    = "all"
+)
+
+func init() {
+	balancer.Register(NewBuilder(Name))
+}
+
+// NewBuilder 创建就近调用负载均衡器，可使用不同名称和配置注册多个
+func NewBuilder(name string, opts ...Option) balancer.Builder {
+	o := new(Options)
+	for _, opt := range opts {
+		opt(o)
+	}
+	// 默认值，未设置的客户端位置在创建连接时读取
+	if o.FailoverThreshold <= 0 || o.FailoverThreshold > 1 {
+		o.FailoverThreshold = defaultFailoverThreshold
+	}
+	if o.Logger == nil {
+		o.Logger = zap.NewNop().Sugar()
+	}
+	return &builder{
+		name: name,
+		opts: o,
+	}
+}
+
+// 负载均衡器，每个连接保存全部节点用于计算可用容量
+type builder struct {
+	name string
+	opts *Options
+}
+
+// Build 创建负载均衡器
+func (b *builder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	o := *b.opts
+	if o.Zone == "" {
+		o.Zone = common.GetZone()
+	}
+	if o.Region == "" {
+		o.Region = common.GetRegion()
+	}
+	pb := &pickerBuilder{
+		name: b.name,
+		opts: &o,
+	}
+	bal := base.NewBalancerBuilderV2(b.name, kitBalancer.DistinctPickerBuilder(pb), base.Config{HealthCheck: true}).Build(cc, opts)
+	return &localityBalancer{
+		Balancer: bal,
+		v2:       bal.(balancer.V2Balancer),
+		pb:       pb,
+	}
+}
+
+// Name 负载均衡器名称
+func (b *builder) Name() string {
+	return b.name
+}
+
+// 在更新节点前保存全部节点
+type localityBalancer struct {
+	balancer.Balancer
+	v2 balancer.V2Balancer
+	pb *pickerBuilder
+}
+
+// UpdateClientConnState 保存全部节点后更新
+func (b *localityBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	b.pb.setAddresses(s.ResolverState.Addresses)
+	return b.v2.UpdateClientConnState(s)
+}
+
+// ResolverError 服务发现错误
+func (b *localityBalancer) ResolverError(err error) {
+	b.v2.ResolverError(err)
+}
+
+// UpdateSubConnState 节点连接状态变化
+func (b *localityBalancer) UpdateSubConnState(sc balancer.SubConn, state balancer.SubConnState) {
+	b.v2.UpdateSubConnState(sc, state)
+}
+
+// 创建 picker
+type pickerBuilder struct {
+	name string
+	opts *Options
+
+	mu    sync.Mutex
+	addrs []resolver.Address // 全部节点，包含不可用节点
+	scope string             // 当前调用范围
+}
+
+// 保存全部节点
+func (pb *pickerBuilder) setAddresses(addrs []resolver.Address) {
+	pb.mu.Lock()
+	pb.addrs = addrs
+	pb.mu.Unlock()
+}
+
+// Build 选择调用范围，使用范围内的可用节点创建 picker
+func (pb *pickerBuilder) Build(info base.PickerBuildInfo) balancer.V2Picker {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPickerV2(balancer.ErrNoSubConnAvailable)
+	}
+	scope := scopeAll
+	for _, s := range []string{scopeZone, scopeRegion} {
+		if pb.enough(s, info) {
+			scope = s
+			break
+		}
+	}
+	if scope != pb.scope {
+		pb.opts.Logger.Infow("就近调用范围变化", "balancer", pb.name, "zone", pb.opts.Zone, "region", pb.opts.Region, "from", pb.scope, "to", scope)
+		pb.scope = scope
+	}
+	p := new(picker)
+	for sc, sci := range info.ReadySCs {
+		if scope != scopeAll && !pb.inScope(scope, sci.Address) {
+			continue
+		}
+		p.rr.Add(sc, kitBalancer.Weight(sci.Address))
+	}
+	return p
+}
+
+// 范围内可用节点权重占全部节点权重的比例是否达到故障转移阈值
+func (pb *pickerBuilder) enough(scope string, info base.PickerBuildInfo) bool {
+	if (scope == scopeZone && pb.opts.Zone == "") || (scope == scopeRegion && pb.opts.Region == "") {
+		return false
+	}
+	total := 0
+	for _, addr := range pb.addrs {
+		if pb.inScope(scope, addr) {
+			total += kitBalancer.Weight(addr)
+		}
+	}
+	ready := 0
+	for _, sci := range info.ReadySCs {
+		if pb.inScope(scope, sci.Address) {
+			ready += kitBalancer.Weight(sci.Address)
+		}
+	}
+	if total == 0 || ready == 0 {
+		return false
+	}
+	return float64(ready)/float64(total) >= pb.opts.FailoverThreshold
+}
+
+// 节点是否在调用范围内
+func (pb *pickerBuilder) inScope(scope string, addr resolver.Address) bool {
+	node, ok := register.NodeFromAddress(addr)
+	if !ok {
+		return false
+	}
+	switch scope {
+	case scopeZone:
+		return node.Metadata[register.MetadataZone] == pb.opts.Zone
+	case scopeRegion:
+		return node.Metadata[register.MetadataRegion] == pb.opts.Region
+	}
+	return true
+}
+
+// 范围内平滑加权轮询
+type picker struct {
+	rr kitBalancer.WeightedRoundRobin
+}
+
+// Pick 选择当前权重最大的节点
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	return balancer.PickResult{SubConn: p.rr.Next()}, nil
+}
@@ -0,0 +1,72 @@
+package locality
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/micro-kit/microkit/plugins/balancer/internal/balancertest"
+	"github.com/micro-kit/microkit/plugins/register"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/resolver"
+)
+
+func TestPick(t *testing.T) {
+	nodes := []*register.Node{
+		balancertest.Node("a1", register.MetadataZone, "a", register.MetadataRegion, "r1"),
+		balancertest.Node("a2", register.MetadataZone, "a", register.MetadataRegion, "r1"),
+		balancertest.Node("b1", register.MetadataZone, "b", register.MetadataRegion, "r1"),
+		balancertest.Node("c1", register.MetadataZone, "c", register.MetadataRegion, "r2"),
+	}
+	tests := []struct {
+		name   string
+		zone   string
+		region string
+		down   []string // 不可用节点
+		want   string   // 选中的节点，按id排序
+	}{
+		{name: "只调用同可用区节点", zone: "a", region: "r1", want: "a1,a2"},
+		{name: "同可用区一半节点可用", zone: "a", region: "r1", down: []string{"a1"}, want: "a2"},
+		{name: "同可用区节点不足时调用同地域节点", zone: "b", region: "r1", down: []string{"b1"}, want: "a1,a2"},
+		{name: "同地域节点不足时调用全部节点", zone: "c", region: "r2", down: []string{"c1"}, want: "a1,a2,b1"},
+		{name: "未设置可用区时调用同地域节点", region: "r1", want: "a1,a2,b1"},
+		{name: "未设置位置时调用全部节点", want: "a1,a2,b1,c1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := &pickerBuilder{
+				name: Name,
+				opts: &Options{
+					Zone:              tt.zone,
+					Region:            tt.region,
+					FailoverThreshold: defaultFailoverThreshold,
+					Logger:            zap.NewNop().Sugar(),
+				},
+			}
+			down := make(map[string]bool)
+			for _, id := range tt.down {
+				down[id] = true
+			}
+			var addrs []resolver.Address
+			var ready []*register.Node
+			for _, n := range nodes {
+				addrs = append(addrs, register.NewAddress(n))
+				if !down[n.Id] {
+					ready = append(ready, n)
+				}
+			}
+			pb.setAddresses(addrs)
+			p := pb.Build(balancertest.BuildInfo(ready...))
+			picked := balancertest.Count(t, p, balancer.PickInfo{}, 20)
+			var got []string
+			for id := range picked {
+				got = append(got, id)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("选中节点 %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
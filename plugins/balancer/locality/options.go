@@ -0,0 +1,51 @@
+package locality
+
+import (
+	"go.uber.org/zap"
+)
+
+/* 就近调用负载均衡器配置 */
+
+const (
+	// 默认故障转移阈值，同可用区可用容量低于50%时使用其它可用区节点
+	defaultFailoverThreshold = 0.5
+)
+
+// Option 实例值设置
+type Option func(*Options)
+
+// Options 就近调用负载均衡器参数
+type Options struct {
+	Zone              string  // 客户端所在可用区
+	Region            string  // 客户端所在地域
+	FailoverThreshold float64 // 故障转移阈值，可用节点权重占全部节点权重的比例低于该值时扩大范围 (0,1]
+	Logger            *zap.SugaredLogger
+}
+
+// Zone 客户端所在可用区，默认在创建连接时从环境变量 SVC_ZONE 获取
+func Zone(zone string) Option {
+	return func(o *Options) {
+		o.Zone = zone
+	}
+}
+
+// Region 客户端所在地域，默认在创建连接时从环境变量 SVC_REGION 获取
+func Region(region string) Option {
+	return func(o *Options) {
+		o.Region = region
+	}
+}
+
+// FailoverThreshold 故障转移阈值，同可用区可用容量低于该比例时扩大到同地域，再低于时扩大到全部节点
+func FailoverThreshold(threshold float64) Option {
+	return func(o *Options) {
+		o.FailoverThreshold = threshold
+	}
+}
+
+// Logger 设置日志对象，记录调用范围变化
+func Logger(logger *zap.SugaredLogger) Option {
+	return func(o *Options) {
+		o.Logger = logger
+	}
+}
@@ -0,0 +1,28 @@
+package outlier
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+/* 节点异常检测监控指标 */
+
+var (
+	// 节点被摘除次数
+	ejectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "microkit",
+		Subsystem: "outlier_detection",
+		Name:      "ejections_total",
+		Help:      "Total number of endpoints ejected by client-side outlier detection.",
+	}, []string{"service", "reason"})
+	// 当前被摘除的节点数
+	ejectedEndpoints = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "microkit",
+		Subsystem: "outlier_detection",
+		Name:      "ejected",
+		Help:      "Number of endpoints currently ejected by client-side outlier detection.",
+	}, []string{"service"})
+)
+
+func init() {
+	prometheus.MustRegister(ejectionsTotal, ejectedEndpoints)
+}
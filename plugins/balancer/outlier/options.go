@@ -0,0 +1,98 @@
+package outlier
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/balancer/roundrobin"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+/* 节点异常检测配置 */
+
+const (
+	// 默认连续错误次数
+	defaultConsecutiveErrors = 5
+	// 默认最低成功率
+	defaultSuccessRateThreshold = 0.5
+	// 默认计算成功率的最少请求数
+	defaultSuccessRateMinRequests = 20
+	// 默认检测间隔
+	defaultInterval = 10 * time.Second
+	// 默认基础摘除时间
+	defaultBaseEjectionTime = 30 * time.Second
+	// 默认最长摘除时间
+	defaultMaxEjectionTime = 300 * time.Second
+	// 默认最多摘除节点百分比
+	defaultMaxEjectionPercent = 10
+)
+
+// Config 每个连接的异常检测配置，通过grpc服务配置 loadBalancingConfig 传入
+type Config struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	ChildPolicy            string        `json:"childPolicy"`            // 实际选择节点的负载均衡器名称，默认 round_robin
+	ConsecutiveErrors      int           `json:"consecutiveErrors"`      // 连续错误达到该次数时摘除节点
+	SuccessRateThreshold   float64       `json:"successRateThreshold"`   // 一个检测间隔内成功率低于该值时摘除节点 (0,1]
+	SuccessRateMinRequests int           `json:"successRateMinRequests"` // 一个检测间隔内请求数达到该值才计算成功率
+	Interval               time.Duration `json:"interval"`               // 检测间隔，按间隔计算成功率、恢复到期节点
+	BaseEjectionTime       time.Duration `json:"baseEjectionTime"`       // 基础摘除时间，摘除时间 = 基础摘除时间 * 连续摘除次数
+	MaxEjectionTime        time.Duration `json:"maxEjectionTime"`        // 最长摘除时间
+	MaxEjectionPercent     int           `json:"maxEjectionPercent"`     // 最多摘除节点百分比，节点数不少于2个时至少可摘除1个
+}
+
+// 默认值
+func (c *Config) setDefaults() {
+	if c.ChildPolicy == "" {
+		c.ChildPolicy = roundrobin.Name
+	}
+	if c.ConsecutiveErrors <= 0 {
+		c.ConsecutiveErrors = defaultConsecutiveErrors
+	}
+	if c.SuccessRateThreshold <= 0 || c.SuccessRateThreshold > 1 {
+		c.SuccessRateThreshold = defaultSuccessRateThreshold
+	}
+	if c.SuccessRateMinRequests <= 0 {
+		c.SuccessRateMinRequests = defaultSuccessRateMinRequests
+	}
+	if c.Interval <= 0 {
+		c.Interval = defaultInterval
+	}
+	if c.BaseEjectionTime <= 0 {
+		c.BaseEjectionTime = defaultBaseEjectionTime
+	}
+	if c.MaxEjectionTime < c.BaseEjectionTime {
+		c.MaxEjectionTime = defaultMaxEjectionTime
+		if c.MaxEjectionTime < c.BaseEjectionTime {
+			c.MaxEjectionTime = c.BaseEjectionTime
+		}
+	}
+	if c.MaxEjectionPercent <= 0 || c.MaxEjectionPercent > 100 {
+		c.MaxEjectionPercent = defaultMaxEjectionPercent
+	}
+}
+
+// ServiceConfig 生成使用异常检测负载均衡器的grpc服务配置，用于 grpc.WithDefaultServiceConfig
+func ServiceConfig(cfg *Config) (string, error) {
+	js, err := json.Marshal([]map[string]*Config{{Name: cfg}})
+	if err != nil {
+		return "", err
+	}
+	return `{"loadBalancingConfig":` + string(js) + `}`, nil
+}
+
+// Option 实例值设置
+type Option func(*Options)
+
+// Options 异常检测负载均衡器参数
+type Options struct {
+	Logger *zap.SugaredLogger
+}
+
+// Logger 设置日志对象，记录节点摘除和恢复，未设置时使用grpc日志
+func Logger(logger *zap.SugaredLogger) Option {
+	return func(o *Options) {
+		o.Logger = logger
+	}
+}
@@ -0,0 +1,514 @@
+package outlier
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	kitBalancer "github.com/micro-kit/microkit/plugins/balancer"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+	"google.golang.org/grpc/status"
+)
+
+/*
+ 节点异常检测负载均衡器
+ 包装其它负载均衡器，按解析到的每个节点统计调用结果
+ 连续返回 Unavailable 或超时达到次数、一个检测间隔内成功率过低的节点被暂时摘除
+ 摘除的节点对被包装的负载均衡器表现为连接失败，到期后恢复，多次摘除时摘除时间递增
+ 同时被摘除的节点数不超过最多摘除节点百分比
+*/
+
+const (
+	// Name 负载均衡器名称，配置通过grpc服务配置传入，参考 ServiceConfig
+	Name = "outlier_detection"
+)
+
+// 摘除原因
+const (
+	reasonConsecutiveErrors = "consecutive_errors"
+	reasonSuccessRate       = "success_rate"
+)
+
+func init() {
+	balancer.Register(NewBuilder(Name))
+}
+
+// NewBuilder 创建节点异常检测负载均衡器，可使用不同名称和配置注册多个
+func NewBuilder(name string, opts ...Option) balancer.Builder {
+	o := new(Options)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &builder{
+		name: name,
+		opts: o,
+	}
+}
+
+// 负载均衡器，每个连接独立统计节点调用结果
+type builder struct {
+	name string
+	opts *Options
+}
+
+// Build 创建负载均衡器，被包装的负载均衡器在收到服务配置后创建
+func (b *builder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	bal := &outlierBalancer{
+		name:      b.name,
+		opts:      b.opts,
+		cc:        cc,
+		buildOpts: opts,
+		service:   serviceName(cc.Target()),
+		endpoints: make(map[string]*endpoint),
+		subConns:  make(map[balancer.SubConn]*endpoint),
+		done:      make(chan struct{}),
+	}
+	return bal
+}
+
+// Name 负载均衡器名称
+func (b *builder) Name() string {
+	return b.name
+}
+
+// ParseConfig 解析服务配置中的异常检测配置
+func (b *builder) ParseConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := new(Config)
+	err := json.Unmarshal(js, cfg)
+	if err != nil {
+		return nil, err
+	}
+	cfg.setDefaults()
+	if balancer.Get(cfg.ChildPolicy) == nil {
+		return nil, fmt.Errorf("负载均衡器未注册: %s", cfg.ChildPolicy)
+	}
+	return cfg, nil
+}
+
+// 服务名 - 连接地址 scheme://authority/{服务名}
+func serviceName(target string) string {
+	return target[strings.LastIndex(target, "/")+1:]
+}
+
+// 单个节点的统计信息，按节点id保存，节点地址重新推送或连接重建时保留
+type endpoint struct {
+	addr   string
+	nodeID string
+
+	consecutive int64 // 连续错误次数
+	successes   int64 // 当前检测间隔内成功次数
+	failures    int64 // 当前检测间隔内失败次数
+
+	// 以下字段由 outlierBalancer.mu 保护
+	subConns     map[balancer.SubConn]connectivity.State // 节点连接 -> 实际连接状态
+	ejected      bool
+	ejectedUntil time.Time
+	ejections    int // 连续摘除次数，决定摘除时间，未被摘除时按检测间隔递减
+}
+
+// 记录一次调用结果，返回连续错误次数，调用方取消的请求不计入
+func (ep *endpoint) record(err error) int64 {
+	if status.Code(err) == codes.Canceled {
+		return 0
+	}
+	if !isFailure(err) {
+		atomic.AddInt64(&ep.successes, 1)
+		atomic.StoreInt64(&ep.consecutive, 0)
+		return 0
+	}
+	atomic.AddInt64(&ep.failures, 1)
+	return atomic.AddInt64(&ep.consecutive, 1)
+}
+
+// 清空统计
+func (ep *endpoint) reset() {
+	atomic.StoreInt64(&ep.consecutive, 0)
+	atomic.StoreInt64(&ep.successes, 0)
+	atomic.StoreInt64(&ep.failures, 0)
+}
+
+// 节点不可用或超时视为节点异常，业务错误和调用方取消不计入
+func isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// 包装被包装负载均衡器，拦截连接状态和 picker
+type outlierBalancer struct {
+	name      string
+	opts      *Options
+	cc        balancer.ClientConn
+	buildOpts balancer.BuildOptions
+	service   string
+
+	// 串行调用被包装的负载均衡器，加锁顺序 childMu -> mu
+	childMu sync.Mutex
+	child   balancer.V2Balancer
+
+	mu        sync.RWMutex
+	cfg       *Config
+	endpoints map[string]*endpoint           // 节点id -> 节点统计
+	subConns  map[balancer.SubConn]*endpoint // 节点连接 -> 节点统计
+	ejected   int                            // 当前被摘除的节点数
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// 创建被包装的负载均衡器并启动检测协程，需持有 childMu
+func (b *outlierBalancer) ensureChild() error {
+	if b.child != nil {
+		return nil
+	}
+	b.mu.RLock()
+	childPolicy := b.cfg.ChildPolicy
+	b.mu.RUnlock()
+	builder := balancer.Get(childPolicy)
+	if builder == nil {
+		return fmt.Errorf("负载均衡器未注册: %s", childPolicy)
+	}
+	child, ok := builder.Build(&wrappedCC{ClientConn: b.cc, b: b}, b.buildOpts).(balancer.V2Balancer)
+	if !ok {
+		return fmt.Errorf("负载均衡器不支持节点异常检测: %s", childPolicy)
+	}
+	b.child = child
+	go b.run()
+	return nil
+}
+
+// UpdateClientConnState 更新配置和节点
+func (b *outlierBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	cfg, _ := s.BalancerConfig.(*Config)
+	if cfg == nil {
+		cfg = new(Config)
+		cfg.setDefaults()
+	}
+	b.childMu.Lock()
+	defer b.childMu.Unlock()
+	b.mu.Lock()
+	b.cfg = cfg
+	b.mu.Unlock()
+	err := b.ensureChild()
+	if err != nil {
+		b.cc.UpdateState(balancer.State{
+			ConnectivityState: connectivity.TransientFailure,
+			Picker:            base.NewErrPickerV2(err),
+		})
+		return err
+	}
+	// 被包装的负载均衡器使用自己的默认配置
+	s.BalancerConfig = nil
+	return b.child.UpdateClientConnState(s)
+}
+
+// ResolverError 服务发现错误
+func (b *outlierBalancer) ResolverError(err error) {
+	b.childMu.Lock()
+	defer b.childMu.Unlock()
+	if b.child == nil {
+		b.cc.UpdateState(balancer.State{
+			ConnectivityState: connectivity.TransientFailure,
+			Picker:            base.NewErrPickerV2(err),
+		})
+		return
+	}
+	b.child.ResolverError(err)
+}
+
+// UpdateSubConnState 节点连接状态变化，被摘除的节点连接成功时仍通知为连接失败
+func (b *outlierBalancer) UpdateSubConnState(sc balancer.SubConn, state balancer.SubConnState) {
+	b.childMu.Lock()
+	defer b.childMu.Unlock()
+	if b.child == nil {
+		return
+	}
+	b.mu.Lock()
+	if ep, ok := b.subConns[sc]; ok {
+		ep.subConns[sc] = state.ConnectivityState
+		if ep.ejected && state.ConnectivityState == connectivity.Ready {
+			state = balancer.SubConnState{ConnectivityState: connectivity.TransientFailure}
+		}
+	}
+	b.mu.Unlock()
+	b.child.UpdateSubConnState(sc, state)
+}
+
+// Close 停止检测并关闭被包装的负载均衡器
+func (b *outlierBalancer) Close() {
+	b.closeOnce.Do(func() {
+		close(b.done)
+	})
+	b.childMu.Lock()
+	defer b.childMu.Unlock()
+	if b.child != nil {
+		b.child.Close()
+	}
+	b.mu.Lock()
+	ejectedEndpoints.WithLabelValues(b.service).Sub(float64(b.ejected))
+	b.ejected = 0
+	b.mu.Unlock()
+}
+
+// HandleSubConnStateChange 已废弃，使用 UpdateSubConnState
+func (b *outlierBalancer) HandleSubConnStateChange(sc balancer.SubConn, state connectivity.State) {
+	grpclog.Error("outlier: HandleSubConnStateChange should not be called")
+}
+
+// HandleResolvedAddrs 已废弃，使用 UpdateClientConnState
+func (b *outlierBalancer) HandleResolvedAddrs(addrs []resolver.Address, err error) {
+	grpclog.Error("outlier: HandleResolvedAddrs should not be called")
+}
+
+// 按检测间隔计算成功率、恢复到期节点
+func (b *outlierBalancer) run() {
+	for {
+		b.mu.RLock()
+		interval := b.cfg.Interval
+		b.mu.RUnlock()
+		select {
+		case <-time.After(interval):
+			b.check()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// 检测一次
+func (b *outlierBalancer) check() {
+	b.childMu.Lock()
+	defer b.childMu.Unlock()
+	select {
+	case <-b.done:
+		return
+	default:
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	for id, ep := range b.endpoints {
+		successes := atomic.SwapInt64(&ep.successes, 0)
+		failures := atomic.SwapInt64(&ep.failures, 0)
+		if ep.ejected {
+			if now.Before(ep.ejectedUntil) {
+				continue
+			}
+			b.unejectLocked(ep)
+			// 摘除期间节点已删除
+			if len(ep.subConns) == 0 {
+				delete(b.endpoints, id)
+			}
+			continue
+		}
+		if ep.ejections > 0 {
+			ep.ejections--
+		}
+		total := successes + failures
+		if total < int64(b.cfg.SuccessRateMinRequests) {
+			continue
+		}
+		if float64(successes)/float64(total) < b.cfg.SuccessRateThreshold {
+			b.ejectLocked(ep, reasonSuccessRate)
+		}
+	}
+}
+
+// 连续错误达到次数时摘除节点
+func (b *outlierBalancer) onConsecutiveErrors(ep *endpoint) {
+	b.childMu.Lock()
+	defer b.childMu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// 节点已删除
+	if b.endpoints[ep.nodeID] != ep {
+		return
+	}
+	b.ejectLocked(ep, reasonConsecutiveErrors)
+}
+
+// 摘除节点，已达最多摘除节点数时不摘除，需持有 childMu 和 mu
+func (b *outlierBalancer) ejectLocked(ep *endpoint, reason string) {
+	if ep.ejected || b.child == nil {
+		return
+	}
+	if b.ejected >= b.maxEjectedLocked() {
+		return
+	}
+	ep.ejections++
+	d := b.cfg.BaseEjectionTime * time.Duration(ep.ejections)
+	if d > b.cfg.MaxEjectionTime {
+		d = b.cfg.MaxEjectionTime
+	}
+	ep.ejected = true
+	ep.ejectedUntil = time.Now().Add(d)
+	ep.reset()
+	b.ejected++
+	ejectionsTotal.WithLabelValues(b.service, reason).Inc()
+	ejectedEndpoints.WithLabelValues(b.service).Inc()
+	b.warnw("节点异常，暂时摘除", "service", b.service, "node_id", ep.nodeID, "addr", ep.addr, "reason", reason, "duration", d.String(), "ejections", ep.ejections)
+	// 已连接的节点通知为连接失败，未连接的节点连接成功时再通知
+	for sc, state := range ep.subConns {
+		if state == connectivity.Ready {
+			b.child.UpdateSubConnState(sc, balancer.SubConnState{ConnectivityState: connectivity.TransientFailure})
+		}
+	}
+}
+
+// 恢复节点，通知实际连接状态，需持有 childMu 和 mu
+func (b *outlierBalancer) unejectLocked(ep *endpoint) {
+	ep.ejected = false
+	ep.reset()
+	b.ejected--
+	ejectedEndpoints.WithLabelValues(b.service).Dec()
+	b.infow("节点摘除到期，恢复调用", "service", b.service, "node_id", ep.nodeID, "addr", ep.addr)
+	for sc, state := range ep.subConns {
+		if state == connectivity.Ready {
+			b.child.UpdateSubConnState(sc, balancer.SubConnState{ConnectivityState: connectivity.Ready})
+		}
+	}
+}
+
+// 最多可同时摘除的节点数，节点数不少于2个时至少可摘除1个
+func (b *outlierBalancer) maxEjectedLocked() int {
+	n := 0
+	for _, ep := range b.endpoints {
+		if len(ep.subConns) > 0 {
+			n++
+		}
+	}
+	max := n * b.cfg.MaxEjectionPercent / 100
+	if max < 1 && n >= 2 {
+		max = 1
+	}
+	return max
+}
+
+// 记录警告日志，未设置日志对象时使用grpc日志
+func (b *outlierBalancer) warnw(msg string, keysAndValues ...interface{}) {
+	if b.opts.Logger != nil {
+		b.opts.Logger.Warnw(msg, keysAndValues...)
+		return
+	}
+	grpclog.Warningf("%s %v", msg, keysAndValues)
+}
+
+// 记录信息日志，未设置日志对象时使用grpc日志
+func (b *outlierBalancer) infow(msg string, keysAndValues ...interface{}) {
+	if b.opts.Logger != nil {
+		b.opts.Logger.Infow(msg, keysAndValues...)
+		return
+	}
+	grpclog.Infof("%s %v", msg, keysAndValues)
+}
+
+// 获取节点连接对应的节点统计信息
+func (b *outlierBalancer) endpoint(sc balancer.SubConn) *endpoint {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.subConns[sc]
+}
+
+// 拦截被包装负载均衡器对连接的操作
+type wrappedCC struct {
+	balancer.ClientConn
+	b *outlierBalancer
+}
+
+// NewSubConn 创建节点连接，同一节点的连接共享节点统计
+func (cc *wrappedCC) NewSubConn(addrs []resolver.Address, opts balancer.NewSubConnOptions) (balancer.SubConn, error) {
+	sc, err := cc.ClientConn.NewSubConn(addrs, opts)
+	if err != nil {
+		return nil, err
+	}
+	var addr resolver.Address
+	if len(addrs) > 0 {
+		addr = addrs[0]
+	}
+	id := kitBalancer.NodeID(addr)
+	cc.b.mu.Lock()
+	ep, ok := cc.b.endpoints[id]
+	if !ok {
+		ep = &endpoint{
+			nodeID:   id,
+			subConns: make(map[balancer.SubConn]connectivity.State),
+		}
+		cc.b.endpoints[id] = ep
+	}
+	ep.addr = addr.Addr
+	ep.subConns[sc] = connectivity.Idle
+	cc.b.subConns[sc] = ep
+	cc.b.mu.Unlock()
+	return sc, nil
+}
+
+// RemoveSubConn 删除节点连接，节点没有连接且未被摘除时删除节点统计
+// 被摘除的节点保留到摘除到期，节点重新注册时仍处于摘除状态
+func (cc *wrappedCC) RemoveSubConn(sc balancer.SubConn) {
+	cc.b.mu.Lock()
+	if ep, ok := cc.b.subConns[sc]; ok {
+		delete(ep.subConns, sc)
+		delete(cc.b.subConns, sc)
+		if len(ep.subConns) == 0 && !ep.ejected {
+			delete(cc.b.endpoints, ep.nodeID)
+		}
+	}
+	cc.b.mu.Unlock()
+	cc.ClientConn.RemoveSubConn(sc)
+}
+
+// UpdateState 包装 picker 统计调用结果
+func (cc *wrappedCC) UpdateState(s balancer.State) {
+	if s.Picker != nil {
+		s.Picker = &picker{
+			V2Picker: s.Picker,
+			b:        cc.b,
+		}
+	}
+	cc.ClientConn.UpdateState(s)
+}
+
+// 统计调用结果
+type picker struct {
+	balancer.V2Picker
+	b *outlierBalancer
+}
+
+// Pick 调用被包装的 picker，调用结束后记录结果
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	res, err := p.V2Picker.Pick(info)
+	if err != nil {
+		return res, err
+	}
+	ep := p.b.endpoint(res.SubConn)
+	if ep == nil {
+		return res, nil
+	}
+	done := res.Done
+	res.Done = func(di balancer.DoneInfo) {
+		if done != nil {
+			done(di)
+		}
+		p.b.mu.RLock()
+		threshold := int64(p.b.cfg.ConsecutiveErrors)
+		p.b.mu.RUnlock()
+		if ep.record(di.Err) >= threshold {
+			p.b.onConsecutiveErrors(ep)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,227 @@
+package outlier
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	kitBalancer "github.com/micro-kit/microkit/plugins/balancer"
+	"github.com/micro-kit/microkit/plugins/balancer/internal/balancertest"
+	"github.com/micro-kit/microkit/plugins/register"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/roundrobin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+)
+
+// 测试用客户端连接，记录节点连接和最新 picker
+type testClientConn struct {
+	balancer.ClientConn
+
+	mu       sync.Mutex
+	subConns map[balancer.SubConn]bool
+	picker   balancer.V2Picker
+}
+
+func (cc *testClientConn) NewSubConn(addrs []resolver.Address, opts balancer.NewSubConnOptions) (balancer.SubConn, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	sc := &balancertest.SubConn{ID: kitBalancer.NodeID(addrs[0])}
+	cc.subConns[sc] = false
+	return sc, nil
+}
+
+func (cc *testClientConn) RemoveSubConn(sc balancer.SubConn) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	delete(cc.subConns, sc)
+}
+
+func (cc *testClientConn) UpdateState(s balancer.State) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.picker = s.Picker
+}
+
+func (cc *testClientConn) Target() string {
+	return "test://author/outlier.test"
+}
+
+func (cc *testClientConn) currentPicker() balancer.V2Picker {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.picker
+}
+
+// 未通知过连接成功的节点连接
+func (cc *testClientConn) newSubConns() []balancer.SubConn {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	var scs []balancer.SubConn
+	for sc, ready := range cc.subConns {
+		if !ready {
+			cc.subConns[sc] = true
+			scs = append(scs, sc)
+		}
+	}
+	return scs
+}
+
+// 测试负载均衡器
+type testBalancer struct {
+	*outlierBalancer
+	cc *testClientConn
+}
+
+// 创建负载均衡器，推送节点地址并全部连接成功
+func newTestBalancer(t *testing.T, cfg *Config, ids ...string) *testBalancer {
+	cc := &testClientConn{subConns: make(map[balancer.SubConn]bool)}
+	tb := &testBalancer{
+		outlierBalancer: NewBuilder(Name).Build(cc, balancer.BuildOptions{}).(*outlierBalancer),
+		cc:              cc,
+	}
+	cfg.ChildPolicy = roundrobin.Name
+	cfg.setDefaults()
+	tb.update(t, cfg, ids...)
+	return tb
+}
+
+// 推送节点地址，每次调用为节点创建新的地址
+func (tb *testBalancer) update(t *testing.T, cfg *Config, ids ...string) {
+	var addrs []resolver.Address
+	for _, n := range balancertest.Nodes(ids...) {
+		addrs = append(addrs, register.NewAddress(n))
+	}
+	err := tb.UpdateClientConnState(balancer.ClientConnState{
+		ResolverState:  resolver.State{Addresses: addrs},
+		BalancerConfig: cfg,
+	})
+	if err != nil {
+		t.Fatalf("UpdateClientConnState() error = %v", err)
+	}
+	for _, sc := range tb.cc.newSubConns() {
+		tb.UpdateSubConnState(sc, balancer.SubConnState{ConnectivityState: connectivity.Ready})
+	}
+}
+
+// 依次调用节点 id，调用结果为 errs，其它节点调用成功
+func (tb *testBalancer) call(t *testing.T, id string, errs ...error) {
+	for i := 0; i < 100*len(errs) && len(errs) > 0; i++ {
+		res, err := tb.cc.currentPicker().Pick(balancer.PickInfo{})
+		if err != nil {
+			t.Fatalf("Pick() error = %v", err)
+		}
+		if balancertest.ID(res) != id {
+			res.Done(balancer.DoneInfo{})
+			continue
+		}
+		res.Done(balancer.DoneInfo{Err: errs[0]})
+		errs = errs[1:]
+	}
+	if len(errs) > 0 {
+		t.Fatalf("节点 %s 未被选中", id)
+	}
+}
+
+// 可以选中的节点，不结束请求，避免改变节点统计
+func (tb *testBalancer) picked(t *testing.T) map[string]bool {
+	picked := make(map[string]bool)
+	for i := 0; i < 30; i++ {
+		res, err := tb.cc.currentPicker().Pick(balancer.PickInfo{})
+		if err != nil {
+			t.Fatalf("Pick() error = %v", err)
+		}
+		picked[balancertest.ID(res)] = true
+	}
+	return picked
+}
+
+// 重复错误
+func repeat(err error, n int) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+var (
+	errUnavailable = status.Error(codes.Unavailable, "unavailable")
+	errDeadline    = status.Error(codes.DeadlineExceeded, "deadline")
+	errNotFound    = status.Error(codes.NotFound, "not found")
+	errCanceled    = status.Error(codes.Canceled, "canceled")
+)
+
+func TestConsecutiveErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		errs        []error
+		wantEjected bool
+	}{
+		{name: "连续不可用", errs: repeat(errUnavailable, 3), wantEjected: true},
+		{name: "连续超时", errs: repeat(errDeadline, 3), wantEjected: true},
+		{name: "未达到连续错误次数", errs: repeat(errUnavailable, 2)},
+		{name: "成功后重新计数", errs: []error{errUnavailable, errUnavailable, nil, errUnavailable, errUnavailable}},
+		{name: "业务错误不计入", errs: repeat(errNotFound, 10)},
+		{name: "调用方取消不计入", errs: repeat(errCanceled, 10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := newTestBalancer(t, &Config{ConsecutiveErrors: 3}, "a", "b", "c")
+			defer tb.Close()
+			tb.call(t, "a", tt.errs...)
+			if got := !tb.picked(t)["a"]; got != tt.wantEjected {
+				t.Errorf("节点 a 摘除 = %v, want %v", got, tt.wantEjected)
+			}
+		})
+	}
+}
+
+func TestSuccessRate(t *testing.T) {
+	tb := newTestBalancer(t, &Config{ConsecutiveErrors: 5, SuccessRateMinRequests: 12, SuccessRateThreshold: 0.5}, "a", "b", "c")
+	defer tb.Close()
+	// 成功率 1/3，连续错误不超过2次
+	for i := 0; i < 4; i++ {
+		tb.call(t, "a", errUnavailable, errUnavailable, nil)
+	}
+	if !tb.picked(t)["a"] {
+		t.Fatal("检测前节点 a 已被摘除")
+	}
+	tb.check()
+	if tb.picked(t)["a"] {
+		t.Fatal("成功率过低的节点 a 未被摘除")
+	}
+	// 摘除到期后恢复
+	tb.mu.Lock()
+	tb.endpoints["a"].ejectedUntil = time.Now()
+	tb.mu.Unlock()
+	tb.check()
+	if !tb.picked(t)["a"] {
+		t.Error("摘除到期的节点 a 未恢复")
+	}
+}
+
+func TestMaxEjectionPercent(t *testing.T) {
+	tb := newTestBalancer(t, &Config{ConsecutiveErrors: 1, MaxEjectionPercent: 10}, "a", "b", "c")
+	defer tb.Close()
+	tb.call(t, "a", errUnavailable)
+	tb.call(t, "b", errUnavailable)
+	picked := tb.picked(t)
+	if picked["a"] || !picked["b"] || !picked["c"] {
+		t.Errorf("选中节点 %v, 只应摘除节点 a", picked)
+	}
+}
+
+func TestEjectionKeptAcrossAddressUpdate(t *testing.T) {
+	cfg := &Config{ConsecutiveErrors: 1}
+	tb := newTestBalancer(t, cfg, "a", "b", "c")
+	defer tb.Close()
+	tb.call(t, "a", errUnavailable)
+	// 节点地址重新推送，连接重建后按节点id保留摘除状态
+	tb.update(t, cfg, "a", "b", "c")
+	if tb.picked(t)["a"] {
+		t.Error("地址重新推送后节点 a 恢复调用")
+	}
+}
@@ -0,0 +1,177 @@
+package p2c
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	kitBalancer "github.com/micro-kit/microkit/plugins/balancer"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+/*
+ P2C-EWMA 负载均衡器
+ 随机选择两个节点，比较 延迟EWMA*(进行中请求数+1)/权重，选择较小的节点
+ 延迟EWMA按时间衰减，较久之前的延迟影响逐渐减小；请求失败时按惩罚延迟计算
+*/
+
+const (
+	// Name 负载均衡器名称
+	Name = "p2c_ewma"
+	// 延迟EWMA衰减时间常数
+	decayTime = 10 * time.Second
+	// 请求失败或新节点已有进行中请求时使用的延迟
+	penaltyLatency = time.Second
+)
+
+func init() {
+	balancer.Register(kitBalancer.NewBuilder(Name, func() base.V2PickerBuilder {
+		return &pickerBuilder{
+			stats: make(map[string]*stats),
+		}
+	}))
+}
+
+// 创建 picker，保存节点统计
+type pickerBuilder struct {
+	mu    sync.Mutex
+	stats map[string]*stats // 节点id -> 统计
+}
+
+// Build 根据可用节点创建 picker，删除不可用节点的统计
+func (pb *pickerBuilder) Build(info base.PickerBuildInfo) balancer.V2Picker {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	ready := make(map[string]struct{}, len(info.ReadySCs))
+	for _, sci := range info.ReadySCs {
+		ready[kitBalancer.NodeID(sci.Address)] = struct{}{}
+	}
+	for id := range pb.stats {
+		if _, ok := ready[id]; !ok {
+			delete(pb.stats, id)
+		}
+	}
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPickerV2(balancer.ErrNoSubConnAvailable)
+	}
+	p := &picker{
+		items: make([]*item, 0, len(info.ReadySCs)),
+	}
+	for sc, sci := range info.ReadySCs {
+		id := kitBalancer.NodeID(sci.Address)
+		st, ok := pb.stats[id]
+		if !ok {
+			st = new(stats)
+			pb.stats[id] = st
+		}
+		st.setWeight(kitBalancer.Weight(sci.Address))
+		p.items = append(p.items, &item{
+			sc:    sc,
+			stats: st,
+		})
+	}
+	return p
+}
+
+// 节点统计，按节点id保存，节点连接重建时保留
+type stats struct {
+	mu       sync.Mutex
+	weight   float64
+	inflight int64     // 进行中请求数
+	ewma     float64   // 延迟EWMA 纳秒
+	last     time.Time // 上次更新延迟时间
+}
+
+// 更新权重
+func (st *stats) setWeight(w int) {
+	st.mu.Lock()
+	st.weight = float64(w)
+	st.mu.Unlock()
+}
+
+// 节点负载，越小越好
+func (st *stats) load() float64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	latency := st.ewma
+	if latency == 0 && st.inflight > 0 {
+		// 新节点没有延迟数据，已有进行中请求时避免请求集中到该节点
+		latency = float64(penaltyLatency)
+	}
+	return latency * float64(st.inflight+1) / st.weight
+}
+
+// 开始请求
+func (st *stats) start() {
+	st.mu.Lock()
+	st.inflight++
+	st.mu.Unlock()
+}
+
+// 请求完成，按时间衰减更新延迟EWMA
+// 调用方取消的请求(如对冲请求中落后的副本)延迟被截断，不更新延迟EWMA
+func (st *stats) done(begin time.Time, err error) {
+	now := time.Now()
+	latency := float64(now.Sub(begin))
+	if err != nil && latency < float64(penaltyLatency) {
+		latency = float64(penaltyLatency)
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.inflight--
+	if isCanceled(err) {
+		return
+	}
+	if st.last.IsZero() {
+		st.ewma = latency
+	} else {
+		w := math.Exp(-float64(now.Sub(st.last)) / float64(decayTime))
+		st.ewma = st.ewma*w + latency*(1-w)
+	}
+	st.last = now
+}
+
+// 是否为调用方取消的请求
+func isCanceled(err error) bool {
+	return err == context.Canceled || status.Code(err) == codes.Canceled
+}
+
+// 节点连接和统计
+type item struct {
+	sc balancer.SubConn
+	*stats
+}
+
+// 随机选择两个节点比较负载
+type picker struct {
+	items []*item
+}
+
+// Pick 选择负载较小的节点
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	best := p.items[0]
+	if len(p.items) > 1 {
+		i := rand.Intn(len(p.items))
+		j := rand.Intn(len(p.items) - 1)
+		if j >= i {
+			j++
+		}
+		best = p.items[i]
+		if other := p.items[j]; other.load() < best.load() {
+			best = other
+		}
+	}
+	best.start()
+	begin := time.Now()
+	return balancer.PickResult{
+		SubConn: best.sc,
+		Done: func(di balancer.DoneInfo) {
+			best.done(begin, di.Err)
+		},
+	}, nil
+}
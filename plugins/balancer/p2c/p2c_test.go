@@ -0,0 +1,126 @@
+package p2c
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micro-kit/microkit/plugins/balancer/internal/balancertest"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newPickerBuilder() *pickerBuilder {
+	return &pickerBuilder{stats: make(map[string]*stats)}
+}
+
+// 节点调用结果
+type call struct {
+	id       string
+	latency  time.Duration
+	err      error
+	inflight bool // 请求未结束
+}
+
+func TestPick(t *testing.T) {
+	tests := []struct {
+		name  string
+		calls []call
+		want  string
+	}{
+		{
+			name: "选择延迟较低的节点",
+			calls: []call{
+				{id: "a", latency: 200 * time.Millisecond},
+				{id: "b", latency: 10 * time.Millisecond},
+			},
+			want: "b",
+		},
+		{
+			name: "失败请求按惩罚延迟计算",
+			calls: []call{
+				{id: "a", latency: time.Millisecond, err: status.Error(codes.Unavailable, "")},
+				{id: "b", latency: 100 * time.Millisecond},
+			},
+			want: "b",
+		},
+		{
+			name: "调用方取消不计入节点错误",
+			calls: []call{
+				{id: "a", latency: time.Millisecond, err: status.Error(codes.Canceled, "")},
+				{id: "b", latency: 10 * time.Millisecond},
+			},
+			want: "a",
+		},
+		{
+			name: "调用方取消的请求不更新延迟",
+			calls: []call{
+				{id: "a", latency: 10 * time.Millisecond},
+				{id: "a", latency: 500 * time.Millisecond, err: context.Canceled},
+				{id: "a", latency: 500 * time.Millisecond, err: status.Error(codes.Canceled, "")},
+				{id: "b", latency: 20 * time.Millisecond},
+			},
+			want: "a",
+		},
+		{
+			name: "新节点已有进行中请求时避免集中",
+			calls: []call{
+				{id: "a", inflight: true},
+			},
+			want: "b",
+		},
+		{
+			name: "进行中请求数乘以延迟",
+			calls: []call{
+				{id: "a", latency: 10 * time.Millisecond},
+				{id: "a", inflight: true},
+				{id: "a", inflight: true},
+				{id: "b", latency: 20 * time.Millisecond},
+			},
+			want: "b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := newPickerBuilder()
+			p := pb.Build(balancertest.BuildInfo(balancertest.Nodes("a", "b")...))
+			for _, c := range tt.calls {
+				st := pb.stats[c.id]
+				st.start()
+				if !c.inflight {
+					st.done(time.Now().Add(-c.latency), c.err)
+				}
+			}
+			for i := 0; i < 10; i++ {
+				res, err := p.Pick(balancer.PickInfo{})
+				if err != nil {
+					t.Fatalf("Pick() error = %v", err)
+				}
+				if id := balancertest.ID(res); id != tt.want {
+					t.Fatalf("Pick() = %s, want %s", id, tt.want)
+				}
+				// 不结束请求，避免改变节点统计
+				pb.stats[tt.want].inflight--
+			}
+		})
+	}
+}
+
+func TestStatsKeptAcrossRebuild(t *testing.T) {
+	pb := newPickerBuilder()
+	pb.Build(balancertest.BuildInfo(balancertest.Nodes("a", "b")...))
+	pb.stats["a"].start()
+	pb.stats["a"].done(time.Now(), status.Error(codes.Unavailable, ""))
+	// 节点地址重新推送，连接重建后按节点id保留延迟统计
+	p := pb.Build(balancertest.BuildInfo(balancertest.Nodes("a", "b")...))
+	res, _ := p.Pick(balancer.PickInfo{})
+	if id := balancertest.ID(res); id != "b" {
+		t.Errorf("Pick() = %s, want b", id)
+	}
+	// 节点删除后统计同时删除
+	pb.Build(balancertest.BuildInfo(balancertest.Nodes("b")...))
+	if _, ok := pb.stats["a"]; ok {
+		t.Errorf("已删除节点的统计未删除")
+	}
+}
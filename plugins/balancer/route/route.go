@@ -0,0 +1,103 @@
+package route
+
+import (
+	"context"
+	"fmt"
+
+	kitBalancer "github.com/micro-kit/microkit/plugins/balancer"
+	"github.com/micro-kit/microkit/plugins/register"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+/*
+ 按版本路由负载均衡器
+ 节点版本从服务注册附加信息 version 读取，请求的目标版本由 Router 或 WithVersion 设置
+ 只调用目标版本的可用节点，未设置目标版本时调用全部可用节点
+ 目标版本没有可用节点时返回 codes.Unavailable，WaitForReady 的调用等待目标版本节点可用
+ 路由规则设置了 Fallback 时目标版本没有可用节点改为调用全部可用节点
+ 节点内按权重平滑加权轮询
+*/
+
+const (
+	// Name 负载均衡器名称
+	Name = "route"
+)
+
+func init() {
+	balancer.Register(base.NewBalancerBuilderV2(Name, kitBalancer.DistinctPickerBuilder(&pickerBuilder{}), base.Config{HealthCheck: true}))
+}
+
+// 上下文目标版本
+type targetKey struct{}
+
+// 请求的目标版本
+type target struct {
+	version  string
+	fallback bool // 目标版本没有可用节点时调用全部可用节点
+}
+
+// WithVersion 指定请求的目标版本，优先于路由规则，目标版本没有可用节点时返回 codes.Unavailable
+func WithVersion(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, targetKey{}, target{version: version})
+}
+
+// 获取请求的目标版本
+func targetFromContext(ctx context.Context) (target, bool) {
+	if ctx == nil {
+		return target{}, false
+	}
+	t, ok := ctx.Value(targetKey{}).(target)
+	return t, ok
+}
+
+// 创建 picker
+type pickerBuilder struct{}
+
+// Build 按版本分组可用节点
+func (pb *pickerBuilder) Build(info base.PickerBuildInfo) balancer.V2Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPickerV2(balancer.ErrNoSubConnAvailable)
+	}
+	p := &picker{
+		all:      new(kitBalancer.WeightedRoundRobin),
+		versions: make(map[string]*kitBalancer.WeightedRoundRobin),
+	}
+	for sc, sci := range info.ReadySCs {
+		weight := kitBalancer.Weight(sci.Address)
+		p.all.Add(sc, weight)
+		node, ok := register.NodeFromAddress(sci.Address)
+		if !ok || node.Metadata[register.MetadataVersion] == "" {
+			continue
+		}
+		version := node.Metadata[register.MetadataVersion]
+		rr, ok := p.versions[version]
+		if !ok {
+			rr = new(kitBalancer.WeightedRoundRobin)
+			p.versions[version] = rr
+		}
+		// 每个版本独立轮询
+		rr.Add(sc, weight)
+	}
+	return p
+}
+
+// 按版本选择节点
+type picker struct {
+	all      *kitBalancer.WeightedRoundRobin            // 全部节点
+	versions map[string]*kitBalancer.WeightedRoundRobin // 版本 -> 节点
+}
+
+// Pick 选择目标版本的节点
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	if t, ok := targetFromContext(info.Ctx); ok {
+		if rr, ok := p.versions[t.version]; ok {
+			return balancer.PickResult{SubConn: rr.Next()}, nil
+		}
+		if !t.fallback {
+			// 按连接失败处理，grpc返回 codes.Unavailable，WaitForReady 的调用等待目标版本节点可用
+			return balancer.PickResult{}, balancer.TransientFailureError(fmt.Errorf("版本 %s 没有可用节点", t.version))
+		}
+	}
+	return balancer.PickResult{SubConn: p.all.Next()}, nil
+}
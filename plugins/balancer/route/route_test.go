@@ -0,0 +1,74 @@
+package route
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micro-kit/microkit/plugins/balancer/internal/balancertest"
+	"github.com/micro-kit/microkit/plugins/register"
+	"google.golang.org/grpc/balancer"
+)
+
+func TestPick(t *testing.T) {
+	p := new(pickerBuilder).Build(balancertest.BuildInfo(
+		balancertest.Node("a", register.MetadataVersion, "v1"),
+		balancertest.Node("b", register.MetadataVersion, "v1"),
+		balancertest.Node("c", register.MetadataVersion, "v2"),
+		balancertest.Node("d"),
+	))
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		want    map[string]bool
+		wantErr bool
+	}{
+		{
+			name: "未设置目标版本时调用全部节点",
+			ctx:  context.Background(),
+			want: map[string]bool{"a": true, "b": true, "c": true, "d": true},
+		},
+		{
+			name: "只调用目标版本节点",
+			ctx:  WithVersion(context.Background(), "v1"),
+			want: map[string]bool{"a": true, "b": true},
+		},
+		{
+			name:    "目标版本没有可用节点",
+			ctx:     WithVersion(context.Background(), "v3"),
+			wantErr: true,
+		},
+		{
+			name: "目标版本没有可用节点时回退到全部节点",
+			ctx:  context.WithValue(context.Background(), targetKey{}, target{version: "v3", fallback: true}),
+			want: map[string]bool{"a": true, "b": true, "c": true, "d": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(map[string]bool)
+			for i := 0; i < 20; i++ {
+				res, err := p.Pick(balancer.PickInfo{Ctx: tt.ctx})
+				if tt.wantErr {
+					// 按连接失败处理，grpc返回 codes.Unavailable
+					tfe, ok := err.(interface{ IsTransientFailure() bool })
+					if !ok || !tfe.IsTransientFailure() {
+						t.Fatalf("Pick() error = %v, want transient failure", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Pick() error = %v", err)
+				}
+				got[balancertest.ID(res)] = true
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("选中节点 %v, want %v", got, tt.want)
+			}
+			for id := range tt.want {
+				if !got[id] {
+					t.Errorf("选中节点 %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package route
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+/*
+ 按版本路由规则
+ 按顺序匹配请求metadata，第一个匹配的规则决定目标版本；都不匹配时按权重随机分配版本
+ 目标版本没有可用节点时返回 codes.Unavailable，规则设置 Fallback 时改为调用全部可用节点
+ 规则可在运行时通过 Update 更新，对之后的请求生效
+*/
+
+// Rules 路由规则
+type Rules struct {
+	Matches []Match `json:"matches"` // 按顺序匹配请求metadata
+	Splits  []Split `json:"splits"`  // 未匹配时按权重分配版本，为空时调用全部节点
+}
+
+// Match 请求metadata精确匹配，例如 x-canary: v2
+type Match struct {
+	Header   string `json:"header"`   // 请求metadata key
+	Value    string `json:"value"`    // 请求metadata值
+	Version  string `json:"version"`  // 目标版本
+	Fallback bool   `json:"fallback"` // 目标版本没有可用节点时调用全部可用节点，默认返回 codes.Unavailable
+}
+
+// Split 按权重分配版本
+// 分配到的版本没有可用节点时同样返回 codes.Unavailable，不会改为分配其它版本
+type Split struct {
+	Version  string `json:"version"`  // 目标版本
+	Weight   int    `json:"weight"`   // 权重，例如 v1:90 v2:10
+	Fallback bool   `json:"fallback"` // 目标版本没有可用节点时调用全部可用节点，默认返回 codes.Unavailable
+}
+
+// 校验规则
+func (r *Rules) validate() error {
+	for _, m := range r.Matches {
+		if m.Header == "" || m.Version == "" {
+			return errors.New("路由规则 header 和 version 不能为空")
+		}
+	}
+	total := 0
+	for _, s := range r.Splits {
+		if s.Version == "" {
+			return errors.New("路由规则 version 不能为空")
+		}
+		if s.Weight < 0 {
+			return errors.New("路由规则 weight 不能小于0")
+		}
+		total += s.Weight
+	}
+	if len(r.Splits) > 0 && total == 0 {
+		return errors.New("路由规则 weight 之和必须大于0")
+	}
+	return nil
+}
+
+// Router 按版本路由，客户端通过 client.Router 使用
+type Router struct {
+	rules atomic.Value // *Rules
+}
+
+// NewRouter 创建路由，规则为nil时调用全部节点
+func NewRouter(rules *Rules) (*Router, error) {
+	r := new(Router)
+	err := r.Update(rules)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Update 更新路由规则，规则无效时返回错误并继续使用旧规则
+func (r *Router) Update(rules *Rules) error {
+	if rules == nil {
+		rules = new(Rules)
+	}
+	err := rules.validate()
+	if err != nil {
+		return err
+	}
+	r.rules.Store(rules)
+	return nil
+}
+
+// Rules 当前路由规则
+func (r *Router) Rules() *Rules {
+	return r.rules.Load().(*Rules)
+}
+
+// Route 获取请求的目标版本，为空表示调用全部节点
+func (r *Router) Route(ctx context.Context) string {
+	return r.route(ctx).version
+}
+
+// 匹配规则获取请求的目标版本
+func (r *Router) route(ctx context.Context) target {
+	rules := r.Rules()
+	if len(rules.Matches) > 0 {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		for _, m := range rules.Matches {
+			for _, v := range md.Get(m.Header) {
+				if v == m.Value {
+					return target{version: m.Version, fallback: m.Fallback}
+				}
+			}
+		}
+	}
+	if len(rules.Splits) == 0 {
+		return target{}
+	}
+	total := 0
+	for _, s := range rules.Splits {
+		total += s.Weight
+	}
+	n := rand.Intn(total)
+	for _, s := range rules.Splits {
+		if n < s.Weight {
+			return target{version: s.Version, fallback: s.Fallback}
+		}
+		n -= s.Weight
+	}
+	return target{}
+}
+
+// UnaryClient 非流式客户端拦截器，根据规则设置目标版本
+func (r *Router) UnaryClient(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(r.withVersion(ctx), method, req, reply, cc, opts...)
+}
+
+// StreamClient 流式客户端拦截器，根据规则设置目标版本
+func (r *Router) StreamClient(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(r.withVersion(ctx), desc, cc, method, opts...)
+}
+
+// 已通过 WithVersion 指定版本时不再匹配规则
+func (r *Router) withVersion(ctx context.Context) context.Context {
+	if _, ok := targetFromContext(ctx); ok {
+		return ctx
+	}
+	if t := r.route(ctx); t.version != "" {
+		return context.WithValue(ctx, targetKey{}, t)
+	}
+	return ctx
+}
@@ -0,0 +1,97 @@
+package route
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRulesValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   *Rules
+		wantErr bool
+	}{
+		{name: "空规则", rules: nil},
+		{name: "匹配规则", rules: &Rules{Matches: []Match{{Header: "x-canary", Value: "1", Version: "v2"}}}},
+		{name: "匹配规则缺少header", rules: &Rules{Matches: []Match{{Value: "1", Version: "v2"}}}, wantErr: true},
+		{name: "匹配规则缺少version", rules: &Rules{Matches: []Match{{Header: "x-canary", Value: "1"}}}, wantErr: true},
+		{name: "权重规则", rules: &Rules{Splits: []Split{{Version: "v1", Weight: 90}, {Version: "v2", Weight: 10}}}},
+		{name: "权重为负数", rules: &Rules{Splits: []Split{{Version: "v1", Weight: -1}}}, wantErr: true},
+		{name: "权重之和为0", rules: &Rules{Splits: []Split{{Version: "v1", Weight: 0}}}, wantErr: true},
+		{name: "权重规则缺少version", rules: &Rules{Splits: []Split{{Weight: 1}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRouter(tt.rules)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewRouter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRoute(t *testing.T) {
+	rules := &Rules{
+		Matches: []Match{
+			{Header: "x-canary", Value: "1", Version: "v2"},
+			{Header: "x-user", Value: "tester", Version: "v3", Fallback: true},
+		},
+		Splits: []Split{{Version: "v1", Weight: 1}},
+	}
+	tests := []struct {
+		name string
+		md   []string
+		want target
+	}{
+		{name: "匹配第一个规则", md: []string{"x-canary", "1"}, want: target{version: "v2"}},
+		{name: "匹配允许回退的规则", md: []string{"x-user", "tester"}, want: target{version: "v3", fallback: true}},
+		{name: "按顺序匹配", md: []string{"x-user", "tester", "x-canary", "1"}, want: target{version: "v2"}},
+		{name: "值不匹配时按权重分配", md: []string{"x-canary", "0"}, want: target{version: "v1"}},
+		{name: "未设置metadata时按权重分配", want: target{version: "v1"}},
+	}
+	r, err := NewRouter(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if len(tt.md) > 0 {
+				ctx = metadata.AppendToOutgoingContext(ctx, tt.md...)
+			}
+			if got := r.route(ctx); got != tt.want {
+				t.Errorf("route() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteSplits(t *testing.T) {
+	r, err := NewRouter(&Rules{Splits: []Split{{Version: "v1", Weight: 3}, {Version: "v2", Weight: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		got[r.Route(context.Background())]++
+	}
+	if got["v1"] < 2700 || got["v1"] > 3300 {
+		t.Errorf("按权重分配 %v, want v1:v2 约 3:1", got)
+	}
+}
+
+func TestUpdateInvalidRules(t *testing.T) {
+	r, err := NewRouter(&Rules{Splits: []Split{{Version: "v1", Weight: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Update(&Rules{Splits: []Split{{Version: "v2", Weight: 0}}}); err == nil {
+		t.Fatal("Update() 无效规则未返回错误")
+	}
+	// 继续使用旧规则
+	if got := r.Route(context.Background()); got != "v1" {
+		t.Errorf("Route() = %s, want v1", got)
+	}
+}
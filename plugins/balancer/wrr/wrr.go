@@ -0,0 +1,47 @@
+package wrr
+
+import (
+	kitBalancer "github.com/micro-kit/microkit/plugins/balancer"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+/*
+ 加权轮询负载均衡器
+ 节点权重从服务注册附加信息 weight 读取，未设置时为1
+ 使用平滑加权轮询，权重高的节点请求不会集中在一起
+*/
+
+const (
+	// Name 负载均衡器名称
+	Name = "weighted_round_robin"
+)
+
+func init() {
+	balancer.Register(base.NewBalancerBuilderV2(Name, kitBalancer.DistinctPickerBuilder(&pickerBuilder{}), base.Config{HealthCheck: true}))
+}
+
+// 创建 picker
+type pickerBuilder struct{}
+
+// Build 根据可用节点创建 picker
+func (pb *pickerBuilder) Build(info base.PickerBuildInfo) balancer.V2Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPickerV2(balancer.ErrNoSubConnAvailable)
+	}
+	p := new(picker)
+	for sc, sci := range info.ReadySCs {
+		p.rr.Add(sc, kitBalancer.Weight(sci.Address))
+	}
+	return p
+}
+
+// 平滑加权轮询
+type picker struct {
+	rr kitBalancer.WeightedRoundRobin
+}
+
+// Pick 选择当前权重最大的节点
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	return balancer.PickResult{SubConn: p.rr.Next()}, nil
+}
@@ -0,0 +1,55 @@
+package wrr
+
+import (
+	"testing"
+
+	"github.com/micro-kit/microkit/plugins/balancer/internal/balancertest"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+func TestPick(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[string]string
+		picks   int
+		want    map[string]int
+	}{
+		{
+			name:    "未设置权重时轮询",
+			weights: map[string]string{"a": "", "b": "", "c": ""},
+			picks:   30,
+			want:    map[string]int{"a": 10, "b": 10, "c": 10},
+		},
+		{
+			name:    "按权重分配",
+			weights: map[string]string{"a": "1", "b": "2", "c": "3"},
+			picks:   60,
+			want:    map[string]int{"a": 10, "b": 20, "c": 30},
+		},
+		{
+			name:    "无效权重按1处理",
+			weights: map[string]string{"a": "0", "b": "x", "c": "2"},
+			picks:   40,
+			want:    map[string]int{"a": 10, "b": 10, "c": 20},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := new(pickerBuilder).Build(balancertest.BuildInfo(balancertest.WeightedNodes(tt.weights)...))
+			got := balancertest.Count(t, p, balancer.PickInfo{}, tt.picks)
+			for id, n := range tt.want {
+				if got[id] != n {
+					t.Errorf("节点 %s 选中 %d 次, want %d, got %v", id, got[id], n, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPickNoReadySubConn(t *testing.T) {
+	p := new(pickerBuilder).Build(base.PickerBuildInfo{})
+	if _, err := p.Pick(balancer.PickInfo{}); err != balancer.ErrNoSubConnAvailable {
+		t.Errorf("Pick() error = %v, want %v", err, balancer.ErrNoSubConnAvailable)
+	}
+}
@@ -0,0 +1,226 @@
+package hedge
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	kitBalancer "github.com/micro-kit/microkit/plugins/balancer"
+	"github.com/micro-kit/microkit/plugins/middleware"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+/*
+ 客户端对冲请求中间件
+ 非流式调用超过等待时间未返回时向其它节点发送副本，使用最先成功的结果并取消其它副本
+ 等待时间固定或按方法最近调用耗时的百分位数计算
+ 副本通过 balancer.PickedNodes 选择不同节点，需要使用 microkit 提供的负载均衡器，grpc 自带的 round_robin 等不会避开已选择的节点
+ 每个方法一个令牌桶作为对冲预算，避免下游变慢时对冲放大请求量
+ 只对只读方法启用，必须通过 Methods 或 FilterOutFunc 指定可对冲的方法，响应不是 proto.Message 时不对冲
+*/
+
+// Hedge 对冲请求中间件
+type Hedge struct {
+	Options *Options
+	budget  *middleware.MethodBudget // 每个方法的对冲预算
+
+	mu        sync.Mutex
+	latencies map[string]*latency // 方法全名 -> 调用耗时
+}
+
+// NewHedge 创建对冲请求中间件
+func NewHedge(opts ...Option) (middleware.Middleware, error) {
+	h := &Hedge{
+		Options:   new(Options),
+		latencies: make(map[string]*latency),
+	}
+	// 配置
+	configure(h, opts...)
+	// 未指定可对冲方法返回错误，避免非只读方法被重复执行
+	if h.Options.Empty() {
+		return nil, errors.New("对冲请求中间件未设置可对冲方法 Methods 或 FilterOutFunc")
+	}
+	h.budget = middleware.NewMethodBudget(h.Options.BudgetRate, h.Options.BudgetBurst)
+	return h, nil
+}
+
+// 配置设置项
+func configure(h *Hedge, ops ...Option) {
+	// 处理设置参数
+	for _, o := range ops {
+		o(h.Options)
+	}
+	// 默认值
+	if len(h.Options.Codes) == 0 {
+		h.Options.Codes = []codes.Code{codes.Unavailable}
+	}
+	if h.Options.Logger == nil {
+		h.Options.Logger = zap.NewNop().Sugar()
+	}
+	if h.Options.MaxAttempts <= 0 {
+		h.Options.MaxAttempts = DefaultMaxAttempts
+	}
+	if h.Options.Delay <= 0 {
+		h.Options.Delay = DefaultDelay
+	}
+	if h.Options.Percentile < 0 || h.Options.Percentile >= 1 {
+		h.Options.Percentile = 0
+	}
+	if h.Options.MinDelay <= 0 {
+		h.Options.MinDelay = DefaultMinDelay
+	}
+	if h.Options.BudgetRate <= 0 {
+		h.Options.BudgetRate = DefaultBudgetRate
+	}
+	if h.Options.BudgetBurst <= 0 {
+		h.Options.BudgetBurst = DefaultBudgetBurst
+	}
+}
+
+// UnaryHandler 非流式中间件，服务端不处理
+func (h *Hedge) UnaryHandler(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	resp, err = handler(ctx, req)
+	return
+}
+
+// StreamHandler 流式中间件，服务端不处理
+func (h *Hedge) StreamHandler(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	err = handler(srv, stream)
+	return
+}
+
+// 单个副本的调用结果
+type result struct {
+	attempt int
+	reply   proto.Message
+	err     error
+}
+
+// UnaryClient 非流式客户端中间件 grpc.UnaryClientInterceptor
+func (h *Hedge) UnaryClient(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
+	msg, ok := reply.(proto.Message)
+	if !ok || h.Options.MaxAttempts < 2 || !h.Options.Match(ctx, method) {
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		return
+	}
+
+	// 返回时取消未完成的副本
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// 副本共享已选择节点，负载均衡器为每个副本选择不同节点
+	ctx = kitBalancer.WithPickedNodes(ctx, kitBalancer.NewPickedNodes())
+	lat := h.latency(method)
+	results := make(chan *result, h.Options.MaxAttempts)
+	// 发送一个副本，每个副本使用独立的响应对象
+	send := func(attempt int) {
+		r := proto.Clone(msg)
+		r.Reset()
+		go func() {
+			begin := time.Now()
+			err := invoker(ctx, method, req, r, cc, opts...)
+			if err == nil {
+				lat.add(time.Since(begin))
+			}
+			results <- &result{attempt: attempt, reply: r, err: err}
+		}()
+	}
+
+	send(0)
+	sent, done := 1, 0
+	timer := time.NewTimer(h.delay(lat))
+	defer timer.Stop()
+	for {
+		select {
+		case res := <-results:
+			done++
+			if res.err == nil {
+				msg.Reset()
+				proto.Merge(msg, res.reply)
+				if res.attempt > 0 {
+					hedgeWins.WithLabelValues(method).Inc()
+				}
+				return nil
+			}
+			err = res.err
+			// 其它错误码直接返回，不再等待其它副本
+			if !middleware.HasCode(err, h.Options.Codes) {
+				return
+			}
+			if done < sent {
+				continue
+			}
+			// 已发送的副本都失败，立即发送下一个副本
+			if !h.hedge(method, sent) {
+				return
+			}
+			send(sent)
+			sent++
+			// 等待时间从新副本发送时重新计算
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(h.delay(lat))
+		case <-timer.C:
+			if !h.hedge(method, sent) {
+				continue
+			}
+			send(sent)
+			sent++
+			timer.Reset(h.delay(lat))
+		}
+	}
+}
+
+// StreamClient 流式服客户中间件 grpc.StreamClientInterceptor，流调用不对冲
+func (h *Hedge) StreamClient(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (cs grpc.ClientStream, err error) {
+	cs, err = streamer(ctx, desc, cc, method, opts...)
+	return
+}
+
+// 是否发送下一个副本，sent 为已发送副本数
+func (h *Hedge) hedge(method string, sent int) bool {
+	if sent >= h.Options.MaxAttempts {
+		return false
+	}
+	if !h.budget.Allow(method) {
+		hedgeBudgetExhausted.WithLabelValues(method).Inc()
+		h.Options.Logger.Debugw("对冲预算已用完，不发送副本", "method", method, "sent", sent)
+		return false
+	}
+	hedgesTotal.WithLabelValues(method).Inc()
+	return true
+}
+
+// 发送下一个副本前的等待时间
+func (h *Hedge) delay(lat *latency) time.Duration {
+	if h.Options.Percentile <= 0 {
+		return h.Options.Delay
+	}
+	d, ok := lat.percentile(h.Options.Percentile)
+	if !ok {
+		return h.Options.Delay
+	}
+	if d < h.Options.MinDelay {
+		d = h.Options.MinDelay
+	}
+	return d
+}
+
+// 获取方法的调用耗时统计
+func (h *Hedge) latency(method string) *latency {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	l, ok := h.latencies[method]
+	if !ok {
+		l = new(latency)
+		h.latencies[method] = l
+	}
+	return l
+}
@@ -0,0 +1,104 @@
+package hedge_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/micro-kit/microkit/client"
+	"github.com/micro-kit/microkit/plugins/middleware/hedge"
+	"github.com/micro-kit/microkit/server"
+	kitTesting "github.com/micro-kit/microkit/testing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// 测试调用的方法
+	checkMethod = "/grpc.health.v1.Health/Check"
+	// 第一次调用的处理时间
+	slowDelay = 300 * time.Millisecond
+)
+
+// 服务端第一次调用变慢或返回错误，启用前不影响调用，通过 UnaryServerMiddleware 添加到服务端
+type slowFirst struct {
+	enabled int32
+	code    codes.Code // 第一次调用返回的错误码，OK 表示变慢
+	calls   int32
+}
+
+func (s *slowFirst) UnaryHandler(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if atomic.LoadInt32(&s.enabled) == 0 || atomic.AddInt32(&s.calls, 1) > 1 {
+		return handler(ctx, req)
+	}
+	if s.code != codes.OK {
+		return nil, status.Error(s.code, "first call")
+	}
+	select {
+	case <-time.After(slowDelay):
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	return handler(ctx, req)
+}
+
+func TestNewHedge(t *testing.T) {
+	if _, err := hedge.NewHedge(); err == nil {
+		t.Error("NewHedge() 未设置可对冲方法时未返回错误")
+	}
+	if _, err := hedge.NewHedge(hedge.Methods(checkMethod)); err != nil {
+		t.Errorf("NewHedge() error = %v", err)
+	}
+}
+
+func TestHedge(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		code      codes.Code
+		wantCode  codes.Code
+		wantCalls int32
+		wantFast  bool // 不等待第一次调用返回
+	}{
+		{name: "第一次调用变慢时发送副本", method: checkMethod, wantCalls: 2, wantFast: true},
+		{name: "第一次调用可继续的错误时立即发送副本", method: checkMethod, code: codes.Unavailable, wantCalls: 2, wantFast: true},
+		{name: "第一次调用不可继续的错误时直接返回", method: checkMethod, code: codes.Internal, wantCode: codes.Internal, wantCalls: 1, wantFast: true},
+		{name: "方法不对冲", method: "/grpc.health.v1.Health/Other", wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hg, err := hedge.NewHedge(hedge.Methods(tt.method), hedge.Delay(20*time.Millisecond))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &slowFirst{code: tt.code}
+			h, err := kitTesting.NewHarness(func(*grpc.Server) {},
+				kitTesting.ServerOption(server.Middleware(kitTesting.UnaryServerMiddleware(s.UnaryHandler))),
+				kitTesting.ClientOption(client.Middleware(hg)),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer h.Close()
+			atomic.StoreInt32(&s.enabled, 1)
+			begin := time.Now()
+			resp, err := healthpb.NewHealthClient(h.Conn()).Check(context.Background(), &healthpb.HealthCheckRequest{})
+			elapsed := time.Since(begin)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("Check() code = %v, want %v", code, tt.wantCode)
+			}
+			if err == nil && resp.Status != healthpb.HealthCheckResponse_SERVING {
+				t.Errorf("Check() status = %v, want SERVING", resp.Status)
+			}
+			if calls := atomic.LoadInt32(&s.calls); calls != tt.wantCalls {
+				t.Errorf("服务端调用 %d 次, want %d", calls, tt.wantCalls)
+			}
+			if fast := elapsed < slowDelay/2; fast != tt.wantFast {
+				t.Errorf("调用耗时 %v, wantFast %v", elapsed, tt.wantFast)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package hedge
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+/* 按方法统计最近调用耗时，计算百分位数 */
+
+const (
+	// 保存最近调用耗时的样本数
+	latencySamples = 256
+	// 样本数达到该值才计算百分位数
+	latencyMinSamples = 32
+	// 新增样本数达到该值时重新计算百分位数
+	latencyRecompute = 16
+)
+
+// 单个方法的调用耗时样本
+type latency struct {
+	mu      sync.Mutex
+	samples [latencySamples]time.Duration // 环形缓冲区
+	n       int                           // 已保存样本数
+	next    int                           // 下一个写入位置
+	dirty   int                           // 上次计算后新增样本数
+	value   time.Duration                 // 上次计算的百分位数
+}
+
+// 记录一次调用耗时
+func (l *latency) add(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % latencySamples
+	if l.n < latencySamples {
+		l.n++
+	}
+	l.dirty++
+}
+
+// 百分位数，样本不足时返回false
+func (l *latency) percentile(p float64) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.n < latencyMinSamples {
+		return 0, false
+	}
+	if l.value == 0 || l.dirty >= latencyRecompute {
+		sorted := make([]time.Duration, l.n)
+		copy(sorted, l.samples[:l.n])
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i] < sorted[j]
+		})
+		l.value = sorted[int(p*float64(l.n-1))]
+		l.dirty = 0
+	}
+	return l.value, true
+}
@@ -0,0 +1,35 @@
+package hedge
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+/* 对冲请求监控指标 */
+
+var (
+	// 发送的对冲副本数，不包含第一次调用
+	hedgesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "microkit",
+		Subsystem: "hedge",
+		Name:      "requests_total",
+		Help:      "Total number of hedged copies sent, excluding the original call.",
+	}, []string{"method"})
+	// 对冲副本先于第一次调用成功返回的次数
+	hedgeWins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "microkit",
+		Subsystem: "hedge",
+		Name:      "wins_total",
+		Help:      "Total number of calls answered first by a hedged copy.",
+	}, []string{"method"})
+	// 对冲预算用完未发送副本的次数
+	hedgeBudgetExhausted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "microkit",
+		Subsystem: "hedge",
+		Name:      "budget_exhausted_total",
+		Help:      "Total number of hedged copies not sent because the hedging budget was exhausted.",
+	}, []string{"method"})
+)
+
+func init() {
+	prometheus.MustRegister(hedgesTotal, hedgeWins, hedgeBudgetExhausted)
+}
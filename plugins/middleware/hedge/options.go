@@ -0,0 +1,99 @@
+package hedge
+
+import (
+	"time"
+
+	"github.com/micro-kit/microkit/plugins/middleware"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+)
+
+// 默认值
+const (
+	// DefaultMaxAttempts 默认最多调用副本数，包含第一次调用
+	DefaultMaxAttempts = 2
+	// DefaultDelay 默认发送下一个副本前的等待时间
+	DefaultDelay = 50 * time.Millisecond
+	// DefaultMinDelay 默认按百分位数计算等待时间时的最小值
+	DefaultMinDelay = time.Millisecond
+	// DefaultBudgetRate 默认每个方法每秒补充的对冲次数
+	DefaultBudgetRate = 10
+	// DefaultBudgetBurst 默认每个方法最多累积的对冲次数
+	DefaultBudgetBurst = 20
+)
+
+// Option 实例值设置
+type Option func(*Options)
+
+// Options 注册相关参数
+type Options struct {
+	middleware.MethodFilter // 允许对冲的方法，FilterOutFunc 和 Methods 至少设置一个
+
+	Codes       []codes.Code // 副本返回这些错误码时继续等待其它副本，其它错误直接返回
+	Logger      *zap.SugaredLogger
+	MaxAttempts int           // 最多调用副本数，包含第一次调用
+	Delay       time.Duration // 发送下一个副本前的等待时间，设置 Percentile 时在样本不足前使用
+	Percentile  float64       // 按方法最近调用耗时的百分位数作为等待时间 (0,1)，如0.95
+	MinDelay    time.Duration // 按百分位数计算等待时间时的最小值
+	/* 对冲预算 - 每个方法一个令牌桶，每发送一个副本消耗一个令牌 */
+	BudgetRate  float64 // 每秒补充的令牌数
+	BudgetBurst int     // 最多累积的令牌数
+}
+
+// FilterOutFunc 设置中间件忽略函数列表，只有返回true的方法对冲
+func FilterOutFunc(filterOutFunc middleware.FilterFunc) Option {
+	return func(o *Options) {
+		o.FilterOutFunc = filterOutFunc
+	}
+}
+
+// Methods 允许对冲的只读方法全名，如 /pkg.Service/Get
+func Methods(methods ...string) Option {
+	return func(o *Options) {
+		o.AddMethods(methods...)
+	}
+}
+
+// Codes 副本返回这些错误码时继续等待其它副本，默认 codes.Unavailable
+func Codes(cs ...codes.Code) Option {
+	return func(o *Options) {
+		o.Codes = cs
+	}
+}
+
+// Logger 设置日志对象
+func Logger(logger *zap.SugaredLogger) Option {
+	return func(o *Options) {
+		o.Logger = logger
+	}
+}
+
+// MaxAttempts 最多调用副本数，包含第一次调用，默认2
+func MaxAttempts(n int) Option {
+	return func(o *Options) {
+		o.MaxAttempts = n
+	}
+}
+
+// Delay 前一个副本超过该时间未返回时发送下一个副本
+func Delay(d time.Duration) Option {
+	return func(o *Options) {
+		o.Delay = d
+	}
+}
+
+// Percentile 按方法最近调用耗时的百分位数作为等待时间，如0.95，不小于 min
+func Percentile(p float64, min time.Duration) Option {
+	return func(o *Options) {
+		o.Percentile = p
+		o.MinDelay = min
+	}
+}
+
+// Budget 每个方法的对冲预算，每秒补充 rate 次，最多累积 burst 次，预算用完后不再发送副本
+func Budget(rate float64, burst int) Option {
+	return func(o *Options) {
+		o.BudgetRate = rate
+		o.BudgetBurst = burst
+	}
+}
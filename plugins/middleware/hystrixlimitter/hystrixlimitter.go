@@ -1,7 +1,7 @@
 package hystrixlimitter
 
 import (
-	"log"
+	"errors"
 
 	"github.com/afex/hystrix-go/hystrix"
 	"github.com/micro-kit/microkit/plugins/middleware"
@@ -17,19 +17,19 @@ type HystrixLimitter struct {
 }
 
 // NewHystrixLimitter 创建熔断限流中间件
-func NewHystrixLimitter(opts ...Option) middleware.Middleware {
+func NewHystrixLimitter(opts ...Option) (middleware.Middleware, error) {
 	hl := &HystrixLimitter{
 		Options: new(Options),
 	}
 	// 配置
 	configure(hl, opts...)
-	// 未设置日志对象退出
+	// 未设置日志对象返回错误
 	if hl.Options.Logger == nil {
-		log.Fatalln("限流熔断中间件未设置日志对象")
+		return nil, errors.New("限流熔断中间件未设置日志对象")
 	}
-	// 如果未设置类型，直接退出
+	// 如果未设置类型，返回错误
 	if hl.Options.Type == "" {
-		hl.Options.Logger.Fatalw("未设置限流熔断中间件类型 server｜client", "options", hl.Options)
+		return nil, errors.New("未设置限流熔断中间件类型 server｜client")
 	}
 	// 如果是服务端-初始化限流器
 	if hl.Options.Type == HystrixLimitterTypeServer {
@@ -40,7 +40,7 @@ func NewHystrixLimitter(opts ...Option) middleware.Middleware {
 	}
 	if hl.Options.Type == HystrixLimitterTypeClient {
 		if hl.Options.ServiceName == "" {
-			hl.Options.Logger.Fatalw("服务名不能为空", "options", hl.Options)
+			return nil, errors.New("限流熔断中间件服务名不能为空")
 		}
 		// 熔断器
 		hystrix.ConfigureCommand(
@@ -54,7 +54,7 @@ func NewHystrixLimitter(opts ...Option) middleware.Middleware {
 			},
 		)
 	}
-	return hl
+	return hl, nil
 }
 
 // 配置设置项
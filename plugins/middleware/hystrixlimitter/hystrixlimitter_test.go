@@ -0,0 +1,33 @@
+package hystrixlimitter
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestNewHystrixLimitter(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{name: "未设置日志对象", opts: []Option{Type(HystrixLimitterTypeServer)}, wantErr: true},
+		{name: "未设置类型", opts: []Option{Logger(logger)}, wantErr: true},
+		{name: "客户端未设置服务名", opts: []Option{Logger(logger), Type(HystrixLimitterTypeClient)}, wantErr: true},
+		{name: "服务端", opts: []Option{Logger(logger), Type(HystrixLimitterTypeServer)}},
+		{name: "客户端", opts: []Option{Logger(logger), Type(HystrixLimitterTypeClient), ServiceName("svc")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewHystrixLimitter(tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewHystrixLimitter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && m == nil {
+				t.Error("NewHystrixLimitter() 返回nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+/*
+ 按方法启用的客户端中间件公共部分
+ 重试、对冲等会重复发送请求的中间件只对显式指定的方法启用，并为每个方法设置令牌桶预算
+*/
+
+// MethodFilter 中间件启用的方法，FilterOutFunc 和 Methods 都设置时需同时满足
+type MethodFilter struct {
+	FilterOutFunc FilterFunc      // 返回true的方法启用
+	Methods       map[string]bool // 启用的方法全名
+}
+
+// AddMethods 添加启用的方法全名，如 /pkg.Service/Get
+func (f *MethodFilter) AddMethods(methods ...string) {
+	if f.Methods == nil {
+		f.Methods = make(map[string]bool, len(methods))
+	}
+	for _, m := range methods {
+		f.Methods[m] = true
+	}
+}
+
+// Empty 是否未设置启用的方法
+func (f *MethodFilter) Empty() bool {
+	return f.FilterOutFunc == nil && len(f.Methods) == 0
+}
+
+// Match 方法是否启用，未设置启用的方法时都不启用
+func (f *MethodFilter) Match(ctx context.Context, method string) bool {
+	if f.Empty() {
+		return false
+	}
+	if f.FilterOutFunc != nil && !f.FilterOutFunc(ctx, method) {
+		return false
+	}
+	if len(f.Methods) > 0 && !f.Methods[method] {
+		return false
+	}
+	return true
+}
+
+// MethodBudget 每个方法一个令牌桶，每重复发送一次请求消耗一个令牌，令牌用完后不再重复发送
+type MethodBudget struct {
+	rate     rate.Limit
+	burst    int
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter // 方法全名 -> 令牌桶
+}
+
+// NewMethodBudget 创建方法预算，每秒补充 r 个令牌，最多累积 burst 个
+func NewMethodBudget(r float64, burst int) *MethodBudget {
+	return &MethodBudget{
+		rate:     rate.Limit(r),
+		burst:    burst,
+		limiters: make(map[string]*rate.Limiter),
+	}
+}
+
+// Allow 消耗方法的一个令牌，令牌用完时返回false
+func (b *MethodBudget) Allow(method string) bool {
+	b.mu.Lock()
+	l, ok := b.limiters[method]
+	if !ok {
+		l = rate.NewLimiter(b.rate, b.burst)
+		b.limiters[method] = l
+	}
+	b.mu.Unlock()
+	return l.Allow()
+}
+
+// HasCode 错误的状态码是否在列表中
+func HasCode(err error, cs []codes.Code) bool {
+	code := status.Code(err)
+	for _, c := range cs {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMethodFilterMatch(t *testing.T) {
+	const method = "/pkg.Service/Get"
+	allow := func(ctx context.Context, fullMethodName string) bool { return true }
+	deny := func(ctx context.Context, fullMethodName string) bool { return false }
+	tests := []struct {
+		name    string
+		filter  MethodFilter
+		methods []string
+		want    bool
+	}{
+		{name: "未设置启用的方法", want: false},
+		{name: "方法在列表中", methods: []string{method}, want: true},
+		{name: "方法不在列表中", methods: []string{"/pkg.Service/Put"}, want: false},
+		{name: "过滤函数启用", filter: MethodFilter{FilterOutFunc: allow}, want: true},
+		{name: "过滤函数不启用", filter: MethodFilter{FilterOutFunc: deny}, methods: []string{method}, want: false},
+		{name: "同时满足过滤函数和列表", filter: MethodFilter{FilterOutFunc: allow}, methods: []string{method}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.filter
+			f.AddMethods(tt.methods...)
+			if got := f.Match(context.Background(), method); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMethodBudget(t *testing.T) {
+	b := NewMethodBudget(0.001, 2)
+	for i := 0; i < 2; i++ {
+		if !b.Allow("/pkg.Service/Get") {
+			t.Fatalf("第 %d 次 Allow() = false, want true", i+1)
+		}
+	}
+	if b.Allow("/pkg.Service/Get") {
+		t.Error("令牌用完后 Allow() = true, want false")
+	}
+	// 每个方法独立预算
+	if !b.Allow("/pkg.Service/Put") {
+		t.Error("其它方法 Allow() = false, want true")
+	}
+}
+
+func TestHasCode(t *testing.T) {
+	cs := []codes.Code{codes.Unavailable, codes.ResourceExhausted}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "错误码在列表中", err: status.Error(codes.Unavailable, ""), want: true},
+		{name: "错误码不在列表中", err: status.Error(codes.Internal, ""), want: false},
+		{name: "非grpc错误", err: errors.New("unknown"), want: false},
+		{name: "没有错误", err: nil, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasCode(tt.err, cs); got != tt.want {
+				t.Errorf("HasCode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
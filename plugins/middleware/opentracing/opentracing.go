@@ -3,8 +3,8 @@ package opentracing
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
-	slog "log"
 	"strings"
 
 	"github.com/micro-kit/microkit/plugins/middleware"
@@ -27,18 +27,18 @@ type Opentracing struct {
 }
 
 // NewOpentracing 创建链路追踪器
-func NewOpentracing(opts ...Option) middleware.Middleware {
+func NewOpentracing(opts ...Option) (middleware.Middleware, error) {
 	opentracing := &Opentracing{
 		Options: new(Options),
 	}
 	// 配置
 	configure(opentracing, opts...)
-	// 未设置日志对象退出
+	// 未设置日志对象返回错误
 	if opentracing.Options.Logger == nil {
-		slog.Fatalln("链路追踪中间件未设置日志对象")
+		return nil, errors.New("链路追踪中间件未设置日志对象")
 	}
 
-	return opentracing
+	return opentracing, nil
 }
 
 // 配置设置项
@@ -0,0 +1,16 @@
+package opentracing
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestNewOpentracing(t *testing.T) {
+	if _, err := NewOpentracing(); err == nil {
+		t.Error("未设置日志对象时 NewOpentracing() 未返回错误")
+	}
+	if _, err := NewOpentracing(Logger(zap.NewNop().Sugar())); err != nil {
+		t.Errorf("NewOpentracing() error = %v", err)
+	}
+}
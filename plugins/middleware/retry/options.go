@@ -0,0 +1,101 @@
+package retry
+
+import (
+	"time"
+
+	"github.com/micro-kit/microkit/plugins/middleware"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+)
+
+// 默认值
+const (
+	// DefaultMaxAttempts 默认最多调用次数，包含第一次调用
+	DefaultMaxAttempts = 3
+	// DefaultInitialBackoff 默认第一次重试前等待时间
+	DefaultInitialBackoff = 100 * time.Millisecond
+	// DefaultMaxBackoff 默认最长等待时间
+	DefaultMaxBackoff = 2 * time.Second
+	// DefaultMultiplier 默认等待时间增长倍数
+	DefaultMultiplier = 2.0
+	// DefaultJitter 默认等待时间随机浮动比例
+	DefaultJitter = 0.2
+	// DefaultBudgetRate 默认每个方法每秒补充的重试次数
+	DefaultBudgetRate = 10
+	// DefaultBudgetBurst 默认每个方法最多累积的重试次数
+	DefaultBudgetBurst = 20
+)
+
+// Option 实例值设置
+type Option func(*Options)
+
+// Options 注册相关参数
+type Options struct {
+	middleware.MethodFilter // 允许重试的方法，FilterOutFunc 和 Methods 至少设置一个
+
+	Codes  []codes.Code // 需要重试的错误码
+	Logger *zap.SugaredLogger
+	/* 退避 */
+	MaxAttempts    int           // 最多调用次数，包含第一次调用
+	InitialBackoff time.Duration // 第一次重试前等待时间
+	MaxBackoff     time.Duration // 最长等待时间
+	Multiplier     float64       // 等待时间增长倍数
+	Jitter         float64       // 等待时间随机浮动比例 [0,1)
+	/* 重试预算 - 每个方法一个令牌桶，每次重试消耗一个令牌 */
+	BudgetRate  float64 // 每秒补充的令牌数
+	BudgetBurst int     // 最多累积的令牌数
+}
+
+// FilterOutFunc 设置中间件忽略函数列表，只有返回true的方法重试
+func FilterOutFunc(filterOutFunc middleware.FilterFunc) Option {
+	return func(o *Options) {
+		o.FilterOutFunc = filterOutFunc
+	}
+}
+
+// Methods 允许重试的幂等方法全名，如 /pkg.Service/Get
+func Methods(methods ...string) Option {
+	return func(o *Options) {
+		o.AddMethods(methods...)
+	}
+}
+
+// Codes 需要重试的错误码，默认 codes.Unavailable
+func Codes(cs ...codes.Code) Option {
+	return func(o *Options) {
+		o.Codes = cs
+	}
+}
+
+// Logger 设置日志对象
+func Logger(logger *zap.SugaredLogger) Option {
+	return func(o *Options) {
+		o.Logger = logger
+	}
+}
+
+// MaxAttempts 最多调用次数，包含第一次调用
+func MaxAttempts(n int) Option {
+	return func(o *Options) {
+		o.MaxAttempts = n
+	}
+}
+
+// Backoff 指数退避参数，第n次重试前等待 min(initial*multiplier^(n-1), max)，并按 jitter 比例随机浮动
+// jitter 取值 [0,1)，为0时不浮动
+func Backoff(initial, max time.Duration, multiplier, jitter float64) Option {
+	return func(o *Options) {
+		o.InitialBackoff = initial
+		o.MaxBackoff = max
+		o.Multiplier = multiplier
+		o.Jitter = jitter
+	}
+}
+
+// Budget 每个方法的重试预算，每秒补充 rate 次，最多累积 burst 次，预算用完后不再重试
+func Budget(rate float64, burst int) Option {
+	return func(o *Options) {
+		o.BudgetRate = rate
+		o.BudgetBurst = burst
+	}
+}
@@ -0,0 +1,143 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/micro-kit/microkit/plugins/middleware"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+/*
+ 客户端重试中间件
+ 非流式调用返回指定错误码时按指数退避重试，等待时间超过调用剩余时间时不再重试
+ 每个方法一个令牌桶作为重试预算，避免下游故障时重试放大请求量
+ 只对幂等方法启用，必须通过 Methods 或 FilterOutFunc 指定可重试的方法
+*/
+
+// Retry 重试中间件
+type Retry struct {
+	Options *Options
+	budget  *middleware.MethodBudget // 每个方法的重试预算
+}
+
+// NewRetry 创建重试中间件
+func NewRetry(opts ...Option) (middleware.Middleware, error) {
+	r := &Retry{
+		Options: new(Options),
+	}
+	// 配置
+	configure(r, opts...)
+	// 未指定可重试方法返回错误，避免非幂等方法被重试
+	if r.Options.Empty() {
+		return nil, errors.New("重试中间件未设置可重试方法 Methods 或 FilterOutFunc")
+	}
+	if r.Options.Jitter < 0 || r.Options.Jitter >= 1 {
+		return nil, errors.New("重试中间件等待时间浮动比例 jitter 取值范围为 [0,1)")
+	}
+	r.budget = middleware.NewMethodBudget(r.Options.BudgetRate, r.Options.BudgetBurst)
+	return r, nil
+}
+
+// 配置设置项
+func configure(r *Retry, ops ...Option) {
+	// 未设置时使用默认值
+	r.Options.Jitter = DefaultJitter
+	// 处理设置参数
+	for _, o := range ops {
+		o(r.Options)
+	}
+	// 默认值
+	if len(r.Options.Codes) == 0 {
+		r.Options.Codes = []codes.Code{codes.Unavailable}
+	}
+	if r.Options.Logger == nil {
+		r.Options.Logger = zap.NewNop().Sugar()
+	}
+	if r.Options.MaxAttempts <= 0 {
+		r.Options.MaxAttempts = DefaultMaxAttempts
+	}
+	if r.Options.InitialBackoff <= 0 {
+		r.Options.InitialBackoff = DefaultInitialBackoff
+	}
+	if r.Options.MaxBackoff < r.Options.InitialBackoff {
+		r.Options.MaxBackoff = DefaultMaxBackoff
+		if r.Options.MaxBackoff < r.Options.InitialBackoff {
+			r.Options.MaxBackoff = r.Options.InitialBackoff
+		}
+	}
+	if r.Options.Multiplier < 1 {
+		r.Options.Multiplier = DefaultMultiplier
+	}
+	if r.Options.BudgetRate <= 0 {
+		r.Options.BudgetRate = DefaultBudgetRate
+	}
+	if r.Options.BudgetBurst <= 0 {
+		r.Options.BudgetBurst = DefaultBudgetBurst
+	}
+}
+
+// UnaryHandler 非流式中间件，服务端不处理
+func (r *Retry) UnaryHandler(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	resp, err = handler(ctx, req)
+	return
+}
+
+// StreamHandler 流式中间件，服务端不处理
+func (r *Retry) StreamHandler(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	err = handler(srv, stream)
+	return
+}
+
+// UnaryClient 非流式客户端中间件 grpc.UnaryClientInterceptor
+func (r *Retry) UnaryClient(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
+	if !r.Options.Match(ctx, method) {
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		if err == nil || attempt >= r.Options.MaxAttempts || !middleware.HasCode(err, r.Options.Codes) {
+			return
+		}
+		// 剩余时间不足以等待时直接返回
+		wait := r.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+			return
+		}
+		// 重试预算用完
+		if !r.budget.Allow(method) {
+			r.Options.Logger.Warnw("重试预算已用完，不再重试", "method", method, "attempt", attempt, "err", err)
+			return
+		}
+		r.Options.Logger.Debugw("调用失败，等待后重试", "method", method, "attempt", attempt, "wait", wait.String(), "err", err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// StreamClient 流式服客户中间件 grpc.StreamClientInterceptor，流调用不重试
+func (r *Retry) StreamClient(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (cs grpc.ClientStream, err error) {
+	cs, err = streamer(ctx, desc, cc, method, opts...)
+	return
+}
+
+// 第 attempt 次重试前的等待时间
+func (r *Retry) backoff(attempt int) time.Duration {
+	d := float64(r.Options.InitialBackoff) * math.Pow(r.Options.Multiplier, float64(attempt-1))
+	if d > float64(r.Options.MaxBackoff) {
+		d = float64(r.Options.MaxBackoff)
+	}
+	// 随机浮动 [1-jitter, 1+jitter)
+	d *= 1 + r.Options.Jitter*(2*rand.Float64()-1)
+	return time.Duration(d)
+}
@@ -0,0 +1,108 @@
+package retry_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/micro-kit/microkit/client"
+	"github.com/micro-kit/microkit/plugins/middleware/retry"
+	"github.com/micro-kit/microkit/server"
+	kitTesting "github.com/micro-kit/microkit/testing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// 测试调用的方法
+	checkMethod = "/grpc.health.v1.Health/Check"
+)
+
+// 服务端前 fail 次调用返回 code，启用前不影响调用，通过 UnaryServerMiddleware 添加到服务端
+type flaky struct {
+	enabled int32
+	fail    int32
+	code    codes.Code
+	calls   int32
+}
+
+func (f *flaky) UnaryHandler(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if atomic.LoadInt32(&f.enabled) == 0 {
+		return handler(ctx, req)
+	}
+	if atomic.AddInt32(&f.calls, 1) <= f.fail {
+		return nil, status.Error(f.code, "flaky")
+	}
+	return handler(ctx, req)
+}
+
+func TestNewRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []retry.Option
+		wantErr bool
+	}{
+		{name: "未设置可重试方法", wantErr: true},
+		{name: "设置可重试方法", opts: []retry.Option{retry.Methods(checkMethod)}},
+		{name: "设置过滤函数", opts: []retry.Option{retry.FilterOutFunc(func(ctx context.Context, fullMethodName string) bool { return true })}},
+		{name: "不浮动", opts: []retry.Option{retry.Methods(checkMethod), retry.Backoff(time.Millisecond, time.Second, 2, 0)}},
+		{name: "浮动比例为1", opts: []retry.Option{retry.Methods(checkMethod), retry.Backoff(time.Millisecond, time.Second, 2, 1)}, wantErr: true},
+		{name: "浮动比例为负数", opts: []retry.Option{retry.Methods(checkMethod), retry.Backoff(time.Millisecond, time.Second, 2, -0.1)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := retry.NewRetry(tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewRetry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		fail      int32
+		code      codes.Code
+		wantCode  codes.Code
+		wantCalls int32
+	}{
+		{name: "重试后成功", method: checkMethod, fail: 2, code: codes.Unavailable, wantCode: codes.OK, wantCalls: 3},
+		{name: "达到最多调用次数", method: checkMethod, fail: 5, code: codes.Unavailable, wantCode: codes.Unavailable, wantCalls: 3},
+		{name: "错误码不重试", method: checkMethod, fail: 1, code: codes.Internal, wantCode: codes.Internal, wantCalls: 1},
+		{name: "方法不重试", method: "/grpc.health.v1.Health/Other", fail: 1, code: codes.Unavailable, wantCode: codes.Unavailable, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := retry.NewRetry(
+				retry.Methods(tt.method),
+				retry.MaxAttempts(3),
+				retry.Backoff(time.Millisecond, 10*time.Millisecond, 2, 0),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := &flaky{fail: tt.fail, code: tt.code}
+			h, err := kitTesting.NewHarness(func(*grpc.Server) {},
+				kitTesting.ServerOption(server.Middleware(kitTesting.UnaryServerMiddleware(f.UnaryHandler))),
+				kitTesting.ClientOption(client.Middleware(r)),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer h.Close()
+			atomic.StoreInt32(&f.enabled, 1)
+			_, err = healthpb.NewHealthClient(h.Conn()).Check(context.Background(), &healthpb.HealthCheckRequest{})
+			if code := status.Code(err); code != tt.wantCode {
+				t.Errorf("Check() code = %v, want %v", code, tt.wantCode)
+			}
+			if calls := atomic.LoadInt32(&f.calls); calls != tt.wantCalls {
+				t.Errorf("服务端调用 %d 次, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
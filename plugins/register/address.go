@@ -0,0 +1,105 @@
+package register
+
+import (
+	"sort"
+
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+)
+
+/* grpc 解析地址携带服务节点信息 */
+
+// 节点信息在 resolver.Address.Attributes 中的key
+type nodeKey struct{}
+
+// NewAddress 根据服务节点创建grpc解析地址，节点信息保存在 Attributes 中
+// 每次调用创建新的 Attributes，grpc负载均衡器按整个地址区分连接，解析器推送地址列表时应使用 AddressCache
+func NewAddress(n *Node) resolver.Address {
+	addr := n.Advertise
+	if addr == "" {
+		addr = n.Address
+	}
+	return resolver.Address{
+		Addr:       addr,
+		Attributes: attributes.New(nodeKey{}, n),
+	}
+}
+
+// NodeFromAddress 从grpc解析地址获取服务节点信息
+func NodeFromAddress(addr resolver.Address) (*Node, bool) {
+	if addr.Attributes == nil {
+		return nil, false
+	}
+	n, ok := addr.Attributes.Value(nodeKey{}).(*Node)
+	return n, ok
+}
+
+// AddressCache 按key缓存grpc解析地址，节点信息不变时复用同一个地址，避免节点变化时重建全部连接
+// 非并发安全，由解析器在推送地址的协程中使用
+type AddressCache struct {
+	entries map[string]*cachedAddress
+}
+
+// 缓存的地址和创建地址时的节点信息
+type cachedAddress struct {
+	node *Node
+	addr resolver.Address
+}
+
+// NewAddressCache 创建地址缓存
+func NewAddressCache() *AddressCache {
+	return &AddressCache{
+		entries: make(map[string]*cachedAddress),
+	}
+}
+
+// Update 根据全部节点生成按key排序的地址列表，只为新增和信息变化的节点创建地址，删除不存在的key
+// changed 表示地址列表与上次相比是否有变化
+func (c *AddressCache) Update(nodes map[string]*Node) (addrs []resolver.Address, changed bool) {
+	keys := make([]string, 0, len(nodes))
+	for key := range nodes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	changed = len(nodes) != len(c.entries)
+	addrs = make([]resolver.Address, 0, len(keys))
+	for _, key := range keys {
+		n := nodes[key]
+		e, ok := c.entries[key]
+		if !ok || !nodeEqual(e.node, n) {
+			e = &cachedAddress{
+				node: n,
+				addr: NewAddress(n),
+			}
+			c.entries[key] = e
+			changed = true
+		}
+		addrs = append(addrs, e.addr)
+	}
+	for key := range c.entries {
+		if _, ok := nodes[key]; !ok {
+			delete(c.entries, key)
+			changed = true
+		}
+	}
+	return addrs, changed
+}
+
+// 节点信息是否相同
+func nodeEqual(a, b *Node) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil {
+		return false
+	}
+	if a.Id != b.Id || a.Address != b.Address || a.Advertise != b.Advertise || len(a.Metadata) != len(b.Metadata) {
+		return false
+	}
+	for k, v := range a.Metadata {
+		if bv, ok := b.Metadata[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
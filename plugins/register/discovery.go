@@ -0,0 +1,46 @@
+package register
+
+import (
+	"errors"
+)
+
+/* 服务发现查询接口 - 与grpc解析器无关，可用于工具和监控面板查询服务和节点 */
+
+var (
+	// ErrWatcherStopped 监听已停止
+	ErrWatcherStopped = errors.New("watcher stopped")
+)
+
+// Discovery 服务发现查询接口
+type Discovery interface {
+	ListServices() ([]string, error)         // 获取全部服务名
+	GetService(name string) ([]*Node, error) // 获取服务全部节点
+	Watch(name string) (Watcher, error)      // 监听服务节点变化
+}
+
+// Watcher 服务节点变化监听
+type Watcher interface {
+	Next() (*Event, error) // 阻塞等待下一个变化事件，停止后返回 ErrWatcherStopped
+	Stop()                 // 停止监听
+}
+
+// EventType 服务节点变化类型
+type EventType string
+
+const (
+	// EventAdd 新增节点
+	EventAdd EventType = "add"
+	// EventUpdate 节点信息变化
+	EventUpdate EventType = "update"
+	// EventRemove 删除节点
+	EventRemove EventType = "remove"
+	// EventSynced 首次获取全部节点完成，之前的新增事件包含全部已有节点，服务没有节点时也会产生
+	EventSynced EventType = "synced"
+)
+
+// Event 服务节点变化事件
+type Event struct {
+	Type EventType // 变化类型
+	Key  string    // 节点唯一标识，同一节点的事件相同，同步完成事件为空
+	Node *Node     // 节点信息，删除时为删除前的节点信息，同步完成事件为nil
+}
@@ -0,0 +1,259 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micro-kit/microkit/plugins/register"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/resolver"
+)
+
+/*
+ DNS服务发现 - 适用于 kubernetes headless service 等环境
+ register.Addrs 为需要解析的域名列表:
+   host:port            解析 A/AAAA 记录，使用指定端口
+   _service._proto.name 解析 SRV 记录，使用记录中的端口
+   host                 解析 A/AAAA 记录，使用 register.DefaultPort 设置的端口
+ 未设置 Addrs 时解析连接地址中的服务名，client.Dial 的服务名不包含端口，需要设置 register.DefaultPort
+ 注册和取消注册不做任何处理，按 RefreshInterval 定时重新解析
+*/
+
+const (
+	// 默认 schema - 不使用 dns 避免覆盖grpc内置的dns解析器
+	defaultSchema = "microkit-dns"
+	// 默认刷新间隔
+	defaultRefreshInterval = 30 * time.Second
+	// 单次解析超时
+	lookupTimeout = 10 * time.Second
+	// ResolveNow 触发解析的最小间隔，grpc在每次连接失败时调用 ResolveNow
+	resolveNowInterval = 5 * time.Second
+)
+
+// DNS DNS服务发现
+type DNS struct {
+	Options *register.Options // 注册服务配置
+}
+
+// NewRegistry 创建DNS服务发现
+func NewRegistry(ops ...register.Option) register.Register {
+	d := &DNS{
+		Options: new(register.Options),
+	}
+	for _, o := range ops {
+		o(d.Options)
+	}
+	// 默认值
+	if d.Options.Schema == "" {
+		d.Options.Schema = defaultSchema
+	}
+	if d.Options.RefreshInterval <= 0 {
+		d.Options.RefreshInterval = defaultRefreshInterval
+	}
+	if d.Options.Logger == nil {
+		d.Options.Logger = zap.NewNop().Sugar()
+	}
+	return d
+}
+
+// Register 什么也不做
+func (d *DNS) Register(n *register.Node) error {
+	return nil
+}
+
+// UnRegister 什么也不做
+func (d *DNS) UnRegister(n *register.Node) error {
+	return nil
+}
+
+// GetResolver 获取客户端发现 grpc Resolver对象 - 每个连接的解析器由 Build 创建
+func (d *DNS) GetResolver() resolver.Resolver {
+	return d
+}
+
+// GetBuilder 获取grpc服务注册Builder对象
+func (d *DNS) GetBuilder() resolver.Builder {
+	return d
+}
+
+// Build grpc resolver接口需要 - 为每个连接创建定时解析的解析器
+func (d *DNS) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	addrs := d.Options.Addrs
+	if len(addrs) == 0 {
+		addrs = []string{target.Endpoint}
+	}
+	names := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		name, err := d.withPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	r := &dnsResolver{
+		options: d.Options,
+		names:   names,
+		cc:      cc,
+		addrs:   register.NewAddressCache(),
+		rn:      make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go r.run()
+	return r, nil
+}
+
+// 域名未包含端口时使用默认端口，SRV 记录不变
+func (d *DNS) withPort(name string) (string, error) {
+	if strings.HasPrefix(name, "_") {
+		return name, nil
+	}
+	if _, _, err := net.SplitHostPort(name); err == nil {
+		return name, nil
+	}
+	if d.Options.DefaultPort <= 0 {
+		return "", fmt.Errorf("dns服务发现地址 %s 未包含端口，需要使用 host:port、SRV 记录或设置 register.DefaultPort", name)
+	}
+	return net.JoinHostPort(name, strconv.Itoa(d.Options.DefaultPort)), nil
+}
+
+// Scheme 相当于服务分类名
+func (d *DNS) Scheme() string {
+	return d.Options.Schema
+}
+
+// ResolveNow 什么也不做
+func (d *DNS) ResolveNow(rn resolver.ResolveNowOptions) {}
+
+// Close 什么也不做
+func (d *DNS) Close() {}
+
+// 单个连接的解析器
+type dnsResolver struct {
+	options   *register.Options
+	names     []string // 需要解析的域名
+	cc        resolver.ClientConn
+	rn        chan struct{} // 立即解析通知
+	done      chan struct{}
+	closeOnce sync.Once
+	addrs     *register.AddressCache // 地址 -> grpc解析地址，地址不变时复用
+	pushed    bool                   // 是否已推送过地址列表
+
+	mu           sync.Mutex
+	lastResolved time.Time // 上次解析时间，用于限制 ResolveNow 频率
+}
+
+// 定时解析
+func (r *dnsResolver) run() {
+	ticker := time.NewTicker(r.options.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		r.mu.Lock()
+		r.lastResolved = time.Now()
+		r.mu.Unlock()
+		r.resolve()
+		select {
+		case <-ticker.C:
+		case <-r.rn:
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// 解析全部域名，地址列表变化时推送
+// 解析失败时保留上次结果，从未解析成功时通知grpc解析错误
+func (r *dnsResolver) resolve() {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	addrList := make([]string, 0)
+	for _, name := range r.names {
+		addrs, err := lookup(ctx, name)
+		if err != nil {
+			r.options.Logger.Warnw("dns解析服务地址错误", "err", err, "name", name)
+			if !r.pushed {
+				r.cc.ReportError(err)
+			}
+			return
+		}
+		addrList = append(addrList, addrs...)
+	}
+	sort.Strings(addrList)
+	nodes := make(map[string]*register.Node, len(addrList))
+	for _, addr := range addrList {
+		nodes[addr] = &register.Node{
+			Id:        addr,
+			Address:   addr,
+			Advertise: addr,
+		}
+	}
+	addrs, changed := r.addrs.Update(nodes)
+	if !changed && r.pushed {
+		return
+	}
+	r.pushed = true
+	r.cc.UpdateState(resolver.State{Addresses: addrs})
+	r.options.Logger.Infow("dns解析服务地址变化", "names", r.names, "addrs", addrList)
+}
+
+// 解析单个域名
+func lookup(ctx context.Context, name string) ([]string, error) {
+	// SRV 记录
+	if strings.HasPrefix(name, "_") {
+		_, srvs, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+		addrs := make([]string, 0)
+		for _, srv := range srvs {
+			hosts, err := net.DefaultResolver.LookupHost(ctx, srv.Target)
+			if err != nil {
+				return nil, err
+			}
+			for _, host := range hosts {
+				addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(int(srv.Port))))
+			}
+		}
+		return addrs, nil
+	}
+	// A/AAAA 记录
+	host, port, err := net.SplitHostPort(name)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		addrs = append(addrs, net.JoinHostPort(h, port))
+	}
+	return addrs, nil
+}
+
+// ResolveNow 立即重新解析，限制触发频率
+func (r *dnsResolver) ResolveNow(rn resolver.ResolveNowOptions) {
+	r.mu.Lock()
+	recent := time.Since(r.lastResolved) < resolveNowInterval
+	r.mu.Unlock()
+	if recent {
+		return
+	}
+	select {
+	case r.rn <- struct{}{}:
+	default:
+	}
+}
+
+// Close 停止解析
+func (r *dnsResolver) Close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+}
@@ -0,0 +1,96 @@
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/micro-kit/microkit/plugins/register"
+	"google.golang.org/grpc/resolver"
+)
+
+// 测试用客户端连接，记录推送的地址列表和错误
+type testClientConn struct {
+	resolver.ClientConn
+	states chan resolver.State
+}
+
+func (cc *testClientConn) UpdateState(s resolver.State) {
+	cc.states <- s
+}
+
+func (cc *testClientConn) ReportError(err error) {}
+
+func TestWithPort(t *testing.T) {
+	tests := []struct {
+		name        string
+		addr        string
+		defaultPort int
+		want        string
+		wantErr     bool
+	}{
+		{name: "包含端口", addr: "svc.ns:8080", want: "svc.ns:8080"},
+		{name: "包含端口时忽略默认端口", addr: "svc.ns:8080", defaultPort: 9090, want: "svc.ns:8080"},
+		{name: "SRV 记录", addr: "_grpc._tcp.svc.ns", want: "_grpc._tcp.svc.ns"},
+		{name: "未包含端口时使用默认端口", addr: "svc.ns", defaultPort: 9090, want: "svc.ns:9090"},
+		{name: "未包含端口且未设置默认端口", addr: "svc.ns", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewRegistry(register.DefaultPort(tt.defaultPort)).(*DNS)
+			got, err := d.withPort(tt.addr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("withPort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("withPort() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildBareServiceName(t *testing.T) {
+	// client.Dial 的服务名不包含端口
+	target := resolver.Target{Endpoint: "localhost"}
+	d := NewRegistry()
+	if _, err := d.GetBuilder().Build(target, &testClientConn{states: make(chan resolver.State, 1)}, resolver.BuildOptions{}); err == nil {
+		t.Fatal("Build() 服务名未包含端口且未设置默认端口时未返回错误")
+	}
+
+	d = NewRegistry(register.DefaultPort(9090), register.RefreshInterval(time.Hour))
+	cc := &testClientConn{states: make(chan resolver.State, 1)}
+	r, err := d.GetBuilder().Build(target, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	select {
+	case s := <-cc.states:
+		if len(s.Addresses) == 0 {
+			t.Fatal("未解析到地址")
+		}
+		for _, addr := range s.Addresses {
+			if n, ok := register.NodeFromAddress(addr); !ok || n.Address != addr.Addr {
+				t.Errorf("地址 %s 节点信息 = %+v", addr.Addr, n)
+			}
+			if _, port, _ := net.SplitHostPort(addr.Addr); port != "9090" {
+				t.Errorf("地址 %s 未使用默认端口 9090", addr.Addr)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待解析地址超时")
+	}
+}
+
+func TestBuildKeepsOptions(t *testing.T) {
+	d := NewRegistry(register.Addrs("localhost"), register.DefaultPort(9090), register.RefreshInterval(time.Hour)).(*DNS)
+	r, err := d.Build(resolver.Target{Endpoint: "svc"}, &testClientConn{states: make(chan resolver.State, 1)}, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	// 多个连接共用配置，创建解析器时不修改配置中的地址
+	if d.Options.Addrs[0] != "localhost" {
+		t.Errorf("Addrs = %v, want [localhost]", d.Options.Addrs)
+	}
+}
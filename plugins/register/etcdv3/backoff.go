@@ -0,0 +1,30 @@
+package etcdv3
+
+import (
+	"math/rand"
+	"time"
+)
+
+/* 重试退避策略 */
+
+const (
+	// 首次重试等待时间
+	backoffBase = 500 * time.Millisecond
+	// 最长重试等待时间
+	backoffMax = 30 * time.Second
+	// 撤销租约超时
+	revokeTimeout = 5 * time.Second
+)
+
+// 第attempt次重试的等待时间，指数增长并加入随机抖动
+func backoff(attempt int) time.Duration {
+	d := backoffBase
+	for i := 0; i < attempt && d < backoffMax; i++ {
+		d *= 2
+	}
+	if d > backoffMax {
+		d = backoffMax
+	}
+	// 抖动范围 [d/2, d)
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
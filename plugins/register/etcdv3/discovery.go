@@ -0,0 +1,560 @@
+package etcdv3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micro-kit/microkit/plugins/register"
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/etcdserver/api/v3rpc/rpctypes"
+	"go.etcd.io/etcd/mvcc/mvccpb"
+)
+
+/*
+ etcd 服务发现查询
+ Watch 为每次调用创建独立监听，Stop 时停止监听
+ 监听中断后从最后处理的版本继续监听，版本被压缩时重新获取全部节点，并与已知节点比较生成变化事件
+ 与etcd断开期间不产生事件，使用方继续使用旧的节点，并通过日志和监控指标提示
+ 设置快照目录时，节点变化后写入快照文件，首次获取失败时使用快照中的节点
+ 同一服务的多个监听只由一个监听写入快照文件，该监听停止后由其它监听接替
+ 事件发送和快照写入不持有节点锁，使用方读取慢或磁盘慢时不影响其它命名空间的监听
+ 全部命名空间首次获取完成后产生同步完成事件，首次获取失败时使用快照中的节点或空列表完成同步
+*/
+
+const (
+	// Resync 触发重新获取全部节点的最小间隔
+	resyncInterval = 5 * time.Second
+	// 变化事件缓冲大小
+	eventBufSize = 128
+	// 获取节点超时，etcd不可用时请求可能一直重试
+	requestTimeout = 5 * time.Second
+)
+
+var (
+	// 需要重新获取全部节点
+	errRelist = errors.New("relist")
+)
+
+// ListServices 获取本命名空间和显式设置的其它命名空间下的全部服务名
+func (p *EtcdV3) ListServices() ([]string, error) {
+	namespaces := []string{p.Scheme()}
+	for _, ns := range p.Options.DiscoverNamespaces {
+		if ns == "" || ns == p.Scheme() {
+			continue
+		}
+		namespaces = append(namespaces, ns)
+	}
+	cli, err := p.client()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	seen := make(map[string]struct{})
+	names := make([]string, 0)
+	for _, ns := range namespaces {
+		// microkit/{namespace}/services/
+		prefix := strings.TrimSuffix(servicePrefix(ns, ""), "/")
+		getResp, err := cli.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+		if err != nil {
+			return nil, err
+		}
+		for _, kv := range getResp.Kvs {
+			// {name}/{id}
+			rest := strings.TrimPrefix(string(kv.Key), prefix)
+			idx := strings.Index(rest, "/")
+			if idx <= 0 {
+				continue
+			}
+			name := rest[:idx]
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// GetService 获取服务全部节点，按etcd key排序
+func (p *EtcdV3) GetService(name string) ([]*register.Node, error) {
+	cli, err := p.client()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	nodes := make([]*register.Node, 0)
+	for _, prefix := range p.discoverPrefixes(name) {
+		getResp, err := cli.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+		if err != nil {
+			return nil, err
+		}
+		for _, kv := range getResp.Kvs {
+			sn, err := p.parseNode(kv.Key, kv.Value)
+			if err != nil {
+				continue
+			}
+			nodes = append(nodes, sn)
+		}
+	}
+	return nodes, nil
+}
+
+// Watch 监听服务节点变化，首先为全部已有节点产生新增事件
+// etcd未连接时不返回错误，在后台持续重试
+func (p *EtcdV3) Watch(name string) (register.Watcher, error) {
+	w := newEtcdWatcher(p, name)
+	w.start()
+	return w, nil
+}
+
+// 解析服务注册信息
+func (p *EtcdV3) parseNode(key, value []byte) (*register.Node, error) {
+	sn := new(register.Node)
+	err := json.Unmarshal(value, sn)
+	if err != nil {
+		p.Options.Logger.Errorw("服务注册信息解析错误", "err", err, "key", string(key), "value", string(value))
+		return nil, err
+	}
+	return sn, nil
+}
+
+// etcd 服务节点变化监听
+type etcdWatcher struct {
+	reg      *EtcdV3
+	name     string // 服务名
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+	events   chan *register.Event
+
+	mu       sync.Mutex
+	nodes    map[string]*register.Node // etcd key -> 节点，包含全部发现的命名空间
+	values   map[string]string         // etcd key -> 注册信息，用于判断节点是否变化
+	watchers []*prefixWatcher
+	unsynced int        // 尚未完成首次获取的命名空间数
+	snapSeq  uint64     // 最后复制的快照序号
+	rsMu     sync.Mutex // Resync 可能在处理事件时同步调用，使用单独的锁
+
+	snapMu   sync.Mutex // 写入快照文件，不持有 mu
+	savedSeq uint64     // 最后写入的快照序号
+}
+
+// 单个命名空间key前缀的监听
+type prefixWatcher struct {
+	prefix     string
+	relist     chan struct{} // Resync 触发重新获取
+	stale      bool          // 是否与etcd断开
+	seeded     bool          // 是否正在使用本地快照中的节点
+	synced     bool          // 是否已完成首次获取
+	lastRelist time.Time     // 上次 Resync 触发时间
+}
+
+// 创建监听
+func newEtcdWatcher(reg *EtcdV3, name string) *etcdWatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &etcdWatcher{
+		reg:    reg,
+		name:   name,
+		ctx:    ctx,
+		cancel: cancel,
+		events: make(chan *register.Event, eventBufSize),
+		nodes:  make(map[string]*register.Node),
+		values: make(map[string]string),
+	}
+}
+
+// 开始监听全部命名空间
+func (w *etcdWatcher) start() {
+	prefixes := w.reg.discoverPrefixes(w.name)
+	w.unsynced = len(prefixes)
+	for _, prefix := range prefixes {
+		pw := &prefixWatcher{
+			prefix: prefix,
+			relist: make(chan struct{}, 1),
+		}
+		w.watchers = append(w.watchers, pw)
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			w.watch(pw)
+		}()
+	}
+}
+
+// Next 阻塞等待下一个变化事件
+func (w *etcdWatcher) Next() (*register.Event, error) {
+	select {
+	case ev := <-w.events:
+		return ev, nil
+	case <-w.ctx.Done():
+		return nil, register.ErrWatcherStopped
+	}
+}
+
+// Stop 停止监听
+func (w *etcdWatcher) Stop() {
+	w.stopOnce.Do(func() {
+		w.cancel()
+		w.wg.Wait()
+		w.reg.releaseSnapshot(w.name, w)
+		for _, pw := range w.watchers {
+			resolverStale.DeleteLabelValues(w.name, pw.prefix)
+			resolverSnapshot.DeleteLabelValues(w.name, pw.prefix)
+		}
+		w.reg.Options.Logger.Infow("停止etcd服务监听", "service_name", w.name)
+	})
+}
+
+// Resync 重新获取全部节点，限制触发频率
+func (w *etcdWatcher) Resync() {
+	w.rsMu.Lock()
+	defer w.rsMu.Unlock()
+	now := time.Now()
+	for _, pw := range w.watchers {
+		if now.Sub(pw.lastRelist) < resyncInterval {
+			continue
+		}
+		pw.lastRelist = now
+		select {
+		case pw.relist <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// watch 监听服务变化，中断后按退避策略重试
+func (w *etcdWatcher) watch(pw *prefixWatcher) {
+	var rev int64 // 最后处理的版本，0 表示需要重新获取全部节点
+	reason := "init"
+	for attempt := 0; ; attempt++ {
+		if rev == 0 {
+			var err error
+			rev, err = w.list(pw, reason)
+			if err != nil {
+				if w.ctx.Err() != nil {
+					return
+				}
+				w.markStale(pw, err)
+				// 首次获取失败时使用本地快照
+				if reason == "init" && attempt == 0 {
+					w.seedSnapshot(pw)
+				}
+				w.markSynced(pw)
+				if !w.sleep(attempt) {
+					return
+				}
+				continue
+			}
+			w.markSynced(pw)
+		}
+		var err error
+		rev, err = w.watchFrom(pw, rev)
+		if w.ctx.Err() != nil {
+			return
+		}
+		switch {
+		case err == errRelist:
+			// Resync 触发，立即重新获取
+			reason = "resolve_now"
+			rev = 0
+			attempt = -1
+			continue
+		case err == rpctypes.ErrCompacted:
+			// 版本已被压缩，无法继续监听，重新获取
+			w.reg.Options.Logger.Warnw("etcd监听版本已被压缩，重新获取服务节点", "service_name", w.name, "prefix", pw.prefix, "rev", rev)
+			reason = "compacted"
+			rev = 0
+		default:
+			// 连接正常时中断，重新开始计算退避时间
+			if !w.isStale(pw) {
+				attempt = 0
+			}
+			w.markStale(pw, err)
+		}
+		if !w.sleep(attempt) {
+			return
+		}
+	}
+}
+
+// 退避等待，监听停止时返回false
+func (w *etcdWatcher) sleep(attempt int) bool {
+	select {
+	case <-time.After(backoff(attempt)):
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
+
+// 获取全部节点，与该前缀下已知节点比较生成变化事件，返回etcd版本
+func (w *etcdWatcher) list(pw *prefixWatcher, reason string) (int64, error) {
+	cli, err := w.reg.client()
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(w.ctx, requestTimeout)
+	defer cancel()
+	getResp, err := cli.Get(ctx, pw.prefix, clientv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+	resolverRelists.WithLabelValues(w.name, pw.prefix, reason).Inc()
+	w.mu.Lock()
+	events := make([]*register.Event, 0)
+	seen := make(map[string]struct{}, len(getResp.Kvs))
+	for _, kv := range getResp.Kvs {
+		key := string(kv.Key)
+		seen[key] = struct{}{}
+		if ev := w.putLocked(key, kv.Key, kv.Value); ev != nil {
+			events = append(events, ev)
+		}
+	}
+	for key := range w.nodes {
+		if !strings.HasPrefix(key, pw.prefix) {
+			continue
+		}
+		if _, ok := seen[key]; !ok {
+			if ev := w.deleteLocked(key); ev != nil {
+				events = append(events, ev)
+			}
+		}
+	}
+	w.markFreshLocked(pw)
+	ss := w.snapshotLocked(len(events) > 0)
+	w.mu.Unlock()
+	w.send(events...)
+	w.saveSnapshot(ss)
+	return getResp.Header.Revision, nil
+}
+
+// 从指定版本之后开始监听，返回最后处理的版本和中断原因
+// PUT 新增或更新节点信息，DELETE 删除节点
+func (w *etcdWatcher) watchFrom(pw *prefixWatcher, rev int64) (int64, error) {
+	cli, err := w.reg.client()
+	if err != nil {
+		return rev, err
+	}
+	ctx, cancel := context.WithCancel(clientv3.WithRequireLeader(w.ctx))
+	defer cancel()
+	rch := cli.Watch(ctx, pw.prefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+	for {
+		select {
+		case <-pw.relist:
+			return rev, errRelist
+		case wresp, ok := <-rch:
+			if !ok {
+				return rev, errors.New("etcd监听通道已关闭")
+			}
+			if wresp.CompactRevision != 0 {
+				return rev, rpctypes.ErrCompacted
+			}
+			if err := wresp.Err(); err != nil {
+				return rev, err
+			}
+			w.mu.Lock()
+			w.markFreshLocked(pw)
+			events := make([]*register.Event, 0, len(wresp.Events))
+			for _, ev := range wresp.Events {
+				key := string(ev.Kv.Key)
+				var e *register.Event
+				switch ev.Type {
+				case mvccpb.PUT:
+					e = w.putLocked(key, ev.Kv.Key, ev.Kv.Value)
+				case mvccpb.DELETE:
+					// DELETE 事件不包含value，按key删除
+					e = w.deleteLocked(key)
+				}
+				if e != nil {
+					events = append(events, e)
+				}
+				w.reg.Options.Logger.Infow("监听到etcd服务变化", "type", ev.Type, "key", key, "value", string(ev.Kv.Value))
+			}
+			ss := w.snapshotLocked(len(events) > 0)
+			w.mu.Unlock()
+			w.send(events...)
+			w.saveSnapshot(ss)
+			if wresp.Header.Revision > rev {
+				rev = wresp.Header.Revision
+			}
+		}
+	}
+}
+
+// 写入节点，返回新节点的新增事件或注册信息变化的更新事件，节点未变化时返回nil，调用时需持有 mu
+func (w *etcdWatcher) putLocked(key string, rawKey, value []byte) *register.Event {
+	old, ok := w.values[key]
+	if ok && old == string(value) {
+		return nil
+	}
+	sn, err := w.reg.parseNode(rawKey, value)
+	if err != nil {
+		return nil
+	}
+	w.nodes[key] = sn
+	w.values[key] = string(value)
+	typ := register.EventAdd
+	if ok {
+		typ = register.EventUpdate
+	}
+	return &register.Event{Type: typ, Key: key, Node: sn}
+}
+
+// 删除节点，返回删除事件，节点不存在时返回nil，调用时需持有 mu
+func (w *etcdWatcher) deleteLocked(key string) *register.Event {
+	sn, ok := w.nodes[key]
+	if !ok {
+		return nil
+	}
+	delete(w.nodes, key)
+	delete(w.values, key)
+	return &register.Event{Type: register.EventRemove, Key: key, Node: sn}
+}
+
+// 使用本地快照中该前缀下的节点，节点按快照中的etcd key保存，etcd恢复后重新获取时比较替换
+func (w *etcdWatcher) seedSnapshot(pw *prefixWatcher) {
+	if w.reg.Options.SnapshotDir == "" {
+		return
+	}
+	file := w.reg.snapshotFile(w.name)
+	ss, err := readSnapshot(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			w.reg.Options.Logger.Errorw("读取服务节点快照错误", "err", err, "service_name", w.name, "file", file)
+		}
+		return
+	}
+	w.mu.Lock()
+	events := make([]*register.Event, 0, len(ss.Nodes))
+	for key, sn := range ss.Nodes {
+		if sn == nil || !strings.HasPrefix(key, pw.prefix) {
+			continue
+		}
+		// 与etcd中的注册信息格式一致，恢复后未变化的节点不产生事件
+		value, err := json.Marshal(sn)
+		if err != nil {
+			continue
+		}
+		if ev := w.putLocked(key, []byte(key), value); ev != nil {
+			events = append(events, ev)
+		}
+	}
+	if len(events) > 0 {
+		pw.seeded = true
+	}
+	w.mu.Unlock()
+	if len(events) == 0 {
+		return
+	}
+	w.send(events...)
+	resolverSnapshot.WithLabelValues(w.name, pw.prefix).Set(1)
+	w.reg.Options.Logger.Warnw("etcd不可用，使用本地快照中的服务节点，节点可能已过期", "service_name", w.name, "prefix", pw.prefix, "file", file, "nodes", len(events), "updated_at", ss.UpdatedAt)
+}
+
+// 复制当前节点用于写入快照，节点未变化或本监听不负责写入快照时返回nil，调用时需持有 mu
+func (w *etcdWatcher) snapshotLocked(changed bool) *snapshot {
+	if !changed || w.reg.Options.SnapshotDir == "" || !w.reg.ownSnapshot(w.name, w) {
+		return nil
+	}
+	nodes := make(map[string]*register.Node, len(w.nodes))
+	for key, sn := range w.nodes {
+		nodes[key] = sn
+	}
+	w.snapSeq++
+	return &snapshot{
+		Service:   w.name,
+		UpdatedAt: time.Now(),
+		Nodes:     nodes,
+		seq:       w.snapSeq,
+	}
+}
+
+// 写入本地快照，多个命名空间的监听协程同时写入时跳过比已写入快照更旧的快照
+func (w *etcdWatcher) saveSnapshot(ss *snapshot) {
+	if ss == nil {
+		return
+	}
+	w.snapMu.Lock()
+	defer w.snapMu.Unlock()
+	if ss.seq <= w.savedSeq {
+		return
+	}
+	w.savedSeq = ss.seq
+	file := w.reg.snapshotFile(w.name)
+	err := writeSnapshot(file, ss)
+	if err != nil {
+		w.reg.Options.Logger.Errorw("写入服务节点快照错误", "err", err, "service_name", w.name, "file", file)
+	}
+}
+
+// 发送事件，缓冲已满时等待使用方读取，监听停止后丢弃
+// 同一前缀的事件只由该前缀的监听协程发送，发送时不持有 mu，使用方读取慢时不影响其它前缀的监听
+func (w *etcdWatcher) send(events ...*register.Event) {
+	for _, ev := range events {
+		select {
+		case w.events <- ev:
+		case <-w.ctx.Done():
+			return
+		}
+	}
+}
+
+// 标记命名空间首次获取完成，全部命名空间完成后产生同步完成事件
+// 每个命名空间发送首次获取的事件后才标记，同步完成事件在全部首次获取的事件之后
+func (w *etcdWatcher) markSynced(pw *prefixWatcher) {
+	w.mu.Lock()
+	if pw.synced {
+		w.mu.Unlock()
+		return
+	}
+	pw.synced = true
+	w.unsynced--
+	synced := w.unsynced == 0
+	w.mu.Unlock()
+	if synced {
+		w.send(&register.Event{Type: register.EventSynced})
+	}
+}
+
+// 是否与etcd断开
+func (w *etcdWatcher) isStale(pw *prefixWatcher) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return pw.stale
+}
+
+// 标记与etcd断开，使用方继续使用旧的节点
+func (w *etcdWatcher) markStale(pw *prefixWatcher, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !pw.stale {
+		pw.stale = true
+		w.reg.Options.Logger.Warnw("etcd服务监听与etcd断开，继续使用旧的服务节点", "err", err, "service_name", w.name, "prefix", pw.prefix, "nodes", len(w.nodes))
+	}
+	resolverStale.WithLabelValues(w.name, pw.prefix).Set(1)
+}
+
+// 标记与etcd连接恢复，调用时需持有 mu
+func (w *etcdWatcher) markFreshLocked(pw *prefixWatcher) {
+	if pw.stale {
+		pw.stale = false
+		w.reg.Options.Logger.Infow("etcd服务监听与etcd连接恢复", "service_name", w.name, "prefix", pw.prefix)
+	}
+	if pw.seeded {
+		pw.seeded = false
+		w.reg.Options.Logger.Infow("etcd服务监听不再使用本地快照", "service_name", w.name, "prefix", pw.prefix)
+	}
+	resolverStale.WithLabelValues(w.name, pw.prefix).Set(0)
+	resolverSnapshot.WithLabelValues(w.name, pw.prefix).Set(0)
+}
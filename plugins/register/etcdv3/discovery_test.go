@@ -0,0 +1,255 @@
+package etcdv3
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/micro-kit/microkit/plugins/register"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/etcdserver/api/v3rpc/rpctypes"
+)
+
+// 等待下一个事件
+func nextEvent(t *testing.T, w register.Watcher) *register.Event {
+	t.Helper()
+	ch := make(chan *register.Event, 1)
+	go func() {
+		ev, err := w.Next()
+		if err != nil {
+			t.Error(err)
+		}
+		ch <- ev
+	}()
+	select {
+	case ev := <-ch:
+		if ev == nil {
+			t.FailNow()
+		}
+		return ev
+	case <-time.After(10 * time.Second):
+		t.Fatal("等待事件超时")
+	}
+	return nil
+}
+
+// 等待下一个事件为 typ 类型，节点id为 id
+func wantEvent(t *testing.T, w register.Watcher, typ register.EventType, id string) {
+	t.Helper()
+	ev := nextEvent(t, w)
+	gotID := ""
+	if ev.Node != nil {
+		gotID = ev.Node.Id
+	}
+	if ev.Type != typ || gotID != id {
+		t.Fatalf("事件 = %s %s, want %s %s", ev.Type, gotID, typ, id)
+	}
+}
+
+// 等待条件满足
+func eventually(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+	}
+}
+
+func TestWatchCompacted(t *testing.T) {
+	cli := newTestClient(t)
+	defer cli.Close()
+	a := registerNode(t, "a", "1")
+	defer a.UnRegister(nil)
+
+	w := newEtcdWatcher(newTestRegistry(t), "svc")
+	defer w.Stop()
+	pw := &prefixWatcher{prefix: w.reg.discoverPrefixes("svc")[0], relist: make(chan struct{}, 1)}
+	w.watchers = append(w.watchers, pw)
+	rev, err := w.list(pw, "init")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantEvent(t, w, register.EventAdd, "a")
+
+	// 断开期间节点变化且版本被压缩
+	b := registerNode(t, "b", "1")
+	defer b.UnRegister(nil)
+	if err := a.UnRegister(nil); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := cli.Get(context.Background(), "compact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.Compact(context.Background(), resp.Header.Revision); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.watchFrom(pw, rev); err != rpctypes.ErrCompacted {
+		t.Fatalf("watchFrom() error = %v, want %v", err, rpctypes.ErrCompacted)
+	}
+
+	// 重新获取后与已知节点比较生成变化事件
+	if _, err := w.list(pw, "compacted"); err != nil {
+		t.Fatal(err)
+	}
+	events := map[string]register.EventType{}
+	for i := 0; i < 2; i++ {
+		ev := nextEvent(t, w)
+		events[ev.Node.Id] = ev.Type
+	}
+	if events["a"] != register.EventRemove || events["b"] != register.EventAdd {
+		t.Errorf("重新获取事件 = %v, want a remove, b add", events)
+	}
+}
+
+func TestWatchResync(t *testing.T) {
+	a := registerNode(t, "a", "1")
+	defer a.UnRegister(nil)
+	reg := newTestRegistry(t)
+	prefix := reg.discoverPrefixes("svc")[0]
+	relists := resolverRelists.WithLabelValues("svc", prefix, "resolve_now")
+	before := testutil.ToFloat64(relists)
+
+	rw, err := reg.Watch("svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rw.Stop()
+	w := rw.(*etcdWatcher)
+	wantEvent(t, w, register.EventAdd, "a")
+	wantEvent(t, w, register.EventSynced, "")
+
+	w.Resync()
+	eventually(t, "Resync 后未重新获取", func() bool { return testutil.ToFloat64(relists) == before+1 })
+	// 限制触发频率
+	w.Resync()
+	time.Sleep(100 * time.Millisecond)
+	if n := testutil.ToFloat64(relists); n != before+1 {
+		t.Errorf("重新获取次数 = %v, want %v", n-before, 1)
+	}
+	// 重新获取后继续监听
+	b := registerNode(t, "b", "1")
+	defer b.UnRegister(nil)
+	wantEvent(t, w, register.EventAdd, "b")
+}
+
+func TestWatchStale(t *testing.T) {
+	reg := newTestRegistry(t, register.Addrs("127.0.0.1:1"), register.LazyConnect(true))
+	prefix := reg.discoverPrefixes("svc")[0]
+	w, err := reg.Watch("svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	// etcd不可用时完成同步并标记为断开
+	wantEvent(t, w, register.EventSynced, "")
+	if v := testutil.ToFloat64(resolverStale.WithLabelValues("svc", prefix)); v != 1 {
+		t.Errorf("stale = %v, want 1", v)
+	}
+}
+
+func TestListServices(t *testing.T) {
+	other := testNamespace(t) + "-other"
+	a := registerNode(t, "a", "1")
+	defer a.UnRegister(nil)
+	b := registerNode(t, "b", "1", register.Name("billing"))
+	defer b.UnRegister(nil)
+	o := registerNode(t, "o", "1", register.Name("other"), register.Schema(other))
+	defer o.UnRegister(nil)
+
+	names, err := newTestRegistry(t).ListServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(names, ","); got != "billing,svc" {
+		t.Errorf("ListServices() = %s, want billing,svc", got)
+	}
+	names, err = newTestRegistry(t, register.DiscoverNamespaces(other)).ListServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(names, ","); got != "billing,other,svc" {
+		t.Errorf("跨命名空间 ListServices() = %s, want billing,other,svc", got)
+	}
+}
+
+func TestGetService(t *testing.T) {
+	b := registerNode(t, "b", "1")
+	defer b.UnRegister(nil)
+	a := registerNode(t, "a", "2")
+	defer a.UnRegister(nil)
+
+	nodes, err := newTestRegistry(t).GetService("svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 || nodes[0].Id != "a" || nodes[0].Metadata["v"] != "2" || nodes[1].Id != "b" {
+		t.Errorf("GetService() = %v, want a, b", nodes)
+	}
+	nodes, err = newTestRegistry(t).GetService("none")
+	if err != nil || len(nodes) != 0 {
+		t.Errorf("GetService() 不存在的服务 = %v, %v, want 空列表", nodes, err)
+	}
+}
+
+func TestWatchEvents(t *testing.T) {
+	cli := newTestClient(t)
+	defer cli.Close()
+	a := registerNode(t, "a", "1")
+	defer a.UnRegister(nil)
+
+	w, err := newTestRegistry(t).Watch("svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	// 已有节点的新增事件之后产生同步完成事件
+	wantEvent(t, w, register.EventAdd, "a")
+	wantEvent(t, w, register.EventSynced, "")
+
+	b := registerNode(t, "b", "1")
+	defer b.UnRegister(nil)
+	wantEvent(t, w, register.EventAdd, "b")
+	key := b.keyPrefix(&register.Node{Id: "b"})
+	val, _ := json.Marshal(&register.Node{Id: "b", Address: "b:1", Metadata: map[string]string{"v": "2"}})
+	if _, err := cli.Put(context.Background(), key, string(val), clientv3.WithIgnoreLease()); err != nil {
+		t.Fatal(err)
+	}
+	wantEvent(t, w, register.EventUpdate, "b")
+	if err := a.UnRegister(nil); err != nil {
+		t.Fatal(err)
+	}
+	wantEvent(t, w, register.EventRemove, "a")
+
+	// 停止后 Next 返回错误
+	w.Stop()
+	if _, err := w.Next(); err != register.ErrWatcherStopped {
+		t.Errorf("停止后 Next() error = %v, want %v", err, register.ErrWatcherStopped)
+	}
+}
+
+func TestWatchSyncedWithoutNodes(t *testing.T) {
+	w, err := newTestRegistry(t, register.DiscoverNamespaces(testNamespace(t)+"-other")).Watch("none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	// 服务没有节点时也产生同步完成事件，且只产生一次
+	wantEvent(t, w, register.EventSynced, "")
+	ch := make(chan *register.Event, 1)
+	go func() {
+		ev, _ := w.Next()
+		ch <- ev
+	}()
+	select {
+	case ev := <-ch:
+		if ev != nil {
+			t.Errorf("同步完成后产生事件 %s", ev.Type)
+		}
+	case <-time.After(200 * time.Millisecond):
+	}
+}
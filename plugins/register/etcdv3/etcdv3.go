@@ -2,31 +2,50 @@ package etcdv3
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"sync"
 	"time"
 
 	"github.com/micro-kit/microkit/plugins/register"
 	"go.etcd.io/etcd/clientv3"
-	"go.etcd.io/etcd/mvcc/mvccpb"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/resolver"
 )
 
 /* 注册服务到etcd v3 */
 
+var (
+	_ register.Register  = (*EtcdV3)(nil)
+	_ register.Discovery = (*EtcdV3)(nil)
+
+	// 连接etcd超时，超时未连接成功返回错误
+	dialTimeout = 10 * time.Second
+)
+
 // EtcdV3 注册服务到etcd v3 api的服务注册中间件
 type EtcdV3 struct {
-	Options *register.Options   // 注册服务配置
-	cli     *clientv3.Client    // etcdv3 客户端
-	srvKey  string              // 服务注册key
-	node    *register.Node      // 注册节点信息
-	cc      resolver.ClientConn // grpc 客户端
+	Options *register.Options // 注册服务配置
+	srvKey  string            // 服务注册key
+	node    *register.Node    // 注册节点信息
+
+	cliMu sync.RWMutex
+	cli   *clientv3.Client // etcdv3 客户端，延迟连接时连接成功前为nil
+
+	mu      sync.Mutex
+	leaseID clientv3.LeaseID   // 当前租约
+	cancel  context.CancelFunc // 停止续期协程
+
+	snapMu     sync.Mutex
+	snapOwners map[string]*etcdWatcher // 服务名 -> 负责写入快照的监听
 }
 
 // NewRegistry 创建一个etcdv3服务注册中间件
-func NewRegistry(ops ...register.Option) register.Register {
+// 连接etcd失败时返回错误，设置 register.LazyConnect 时在后台持续重试连接
+func NewRegistry(ops ...register.Option) (register.Register, error) {
 	etcdV3 := &EtcdV3{
 		Options: new(register.Options),
 	}
@@ -35,9 +54,13 @@ func NewRegistry(ops ...register.Option) register.Register {
 	// 创建etcd客户端对象
 	err := etcdV3.initEtcdCli()
 	if err != nil {
-		etcdV3.Options.Logger.Fatalw("连接etcd服务错误", "err", err, "addrs", etcdV3.Options.Addrs)
+		if !etcdV3.Options.LazyConnect {
+			return nil, err
+		}
+		etcdV3.Options.Logger.Warnw("连接etcd服务错误，后台持续重试", "err", err, "addrs", etcdV3.Options.Addrs)
+		go etcdV3.connectLoop()
 	}
-	return etcdV3
+	return etcdV3, nil
 }
 
 // 配置设置项
@@ -52,90 +75,256 @@ func configure(etcdV3 *EtcdV3, ops ...register.Option) {
 	if etcdV3.Options.TTL <= 0 {
 		etcdV3.Options.TTL = 10
 	}
+	if etcdV3.Options.Logger == nil {
+		etcdV3.Options.Logger = zap.NewNop().Sugar()
+	}
 }
 
 // 初始化etcd服务连接
-func (p *EtcdV3) initEtcdCli() (err error) {
-	p.cli, err = clientv3.New(clientv3.Config{
+func (p *EtcdV3) initEtcdCli() error {
+	cfg := clientv3.Config{
 		Endpoints:   p.Options.Addrs,
-		DialTimeout: 10 * time.Second,
-	})
+		DialTimeout: dialTimeout,
+		// 阻塞等待连接成功，etcd不可用时返回错误
+		DialOptions: []grpc.DialOption{grpc.WithBlock()},
+		Username:    p.Options.Username,
+		Password:    p.Options.Password,
+	}
+	// 加密连接
+	if p.Options.Secure || p.Options.TLSConfig != nil {
+		cfg.TLS = p.Options.TLSConfig
+		if cfg.TLS == nil {
+			cfg.TLS = &tls.Config{}
+		}
+	}
+	cli, err := clientv3.New(cfg)
 	if err != nil {
-		p.Options.Logger.Errorw("连接etcd服务错误", "err", err, "addrs", p.Options.Addrs)
-		log.Fatalln("连接etcd服务错误", err)
 		return err
 	}
+	p.cliMu.Lock()
+	p.cli = cli
+	p.cliMu.Unlock()
 	return nil
 }
 
+// 按退避策略持续重试连接etcd，直到连接成功
+func (p *EtcdV3) connectLoop() {
+	for attempt := 0; ; attempt++ {
+		time.Sleep(backoff(attempt))
+		err := p.initEtcdCli()
+		if err == nil {
+			p.Options.Logger.Infow("连接etcd服务成功", "addrs", p.Options.Addrs)
+			return
+		}
+		p.Options.Logger.Warnw("连接etcd服务错误", "err", err, "addrs", p.Options.Addrs, "attempt", attempt)
+	}
+}
+
+// 获取etcd客户端，未连接时返回错误
+func (p *EtcdV3) client() (*clientv3.Client, error) {
+	p.cliMu.RLock()
+	defer p.cliMu.RUnlock()
+	if p.cli == nil {
+		return nil, errors.New("etcd服务未连接")
+	}
+	return p.cli, nil
+}
+
 // Register 注册一个服务
+// 使用一个租约写入注册信息并持续续期，租约丢失后按退避策略重新注册
+// 设置 register.LazyConnect 时首次注册失败不返回错误，在后台持续重试
 func (p *EtcdV3) Register(n *register.Node) error {
 	if n == nil {
 		return errors.New("服务注册信息不能为nil")
 	}
+	p.mu.Lock()
+	if p.cancel != nil {
+		p.mu.Unlock()
+		return errors.New("服务已注册")
+	}
 	p.node = n
-	// 定时器每隔多少秒续期一次
-	ticker := time.NewTicker(time.Second * time.Duration(p.Options.TTL))
 	// 服务存储地址 - 服务名/服务id
 	p.srvKey = p.keyPrefix(n)
-	// 协程内定时续期
-	go func() {
-		for {
-			getResp, err := p.cli.Get(context.Background(), p.srvKey)
-			if err != nil {
-				p.Options.Logger.Warnw("续期服务注册信息，查询错误", "err", err, "srvKey", p.srvKey)
-			} else if getResp.Count == 0 {
-				err = p.withAlive()
-				if err != nil {
-					p.Options.Logger.Warnw("续期服务注册信息，续期错误", "err", err, "srvKey", p.srvKey)
-				}
-			} else {
-				// 存在则什么也做
-			}
-			<-ticker.C
+	srvKey := p.srvKey
+	ctx, cancel := context.WithCancel(context.Background())
+	// 首次注册失败直接返回错误，延迟连接时在后台重试
+	state := register.RegisterStateRegistered
+	ch, id, err := p.grantAndPut(ctx, n, srvKey)
+	if err != nil {
+		if !p.Options.LazyConnect {
+			p.mu.Unlock()
+			cancel()
+			return err
 		}
-	}()
+		p.Options.Logger.Warnw("服务注册错误，后台持续重试", "err", err, "srvKey", srvKey)
+		state = register.RegisterStateLost
+	}
+	p.leaseID = id
+	p.cancel = cancel
+	p.mu.Unlock()
+	// 不持有锁调用回调，回调中可以调用 Register 和 UnRegister
+	p.emit(n, state, err)
+	// 协程内消费续期响应，在通知注册结果后启动，保证状态变化按顺序通知
+	go p.keepAlive(ctx, ch, n, srvKey)
 	return nil
 }
 
-// 获取服务存储key前缀
+// 获取服务存储key前缀 - 命名空间(Schema)作为key的一部分，不同环境互相隔离
+// microkit/{namespace}/services/{name}/{id}
 func (p *EtcdV3) keyPrefix(n *register.Node) string {
 	if n == nil {
-		return fmt.Sprintf("microkit/services/%s/", p.Options.Name)
+		return servicePrefix(p.Scheme(), p.Options.Name)
 	}
-	return fmt.Sprintf("microkit/services/%s/%s", p.Options.Name, n.Id)
+	return servicePrefix(p.Scheme(), p.Options.Name) + n.Id
 }
 
-// 续期
-func (p *EtcdV3) withAlive() error {
-	leaseResp, err := p.cli.Grant(context.Background(), p.Options.TTL)
+// 服务在指定命名空间下的key前缀
+func servicePrefix(namespace, name string) string {
+	return fmt.Sprintf("microkit/%s/services/%s/", namespace, name)
+}
+
+// 服务发现需要监听的key前缀 - 本命名空间和显式设置的其它命名空间
+func (p *EtcdV3) discoverPrefixes(name string) []string {
+	prefixes := []string{servicePrefix(p.Scheme(), name)}
+	for _, ns := range p.Options.DiscoverNamespaces {
+		if ns == "" || ns == p.Scheme() {
+			continue
+		}
+		prefixes = append(prefixes, servicePrefix(ns, name))
+	}
+	return prefixes
+}
+
+// 创建租约并写入注册信息，返回续期响应通道和租约
+func (p *EtcdV3) grantAndPut(ctx context.Context, n *register.Node, srvKey string) (<-chan *clientv3.LeaseKeepAliveResponse, clientv3.LeaseID, error) {
+	cli, err := p.client()
 	if err != nil {
-		return err
+		return nil, 0, err
+	}
+	// etcd不可用时请求可能一直重试，限制单次注册时间
+	reqCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	leaseResp, err := cli.Grant(reqCtx, p.Options.TTL)
+	if err != nil {
+		return nil, 0, err
 	}
 	// 服务注册信息 - 包含node全部信息
-	addr, err := json.Marshal(p.node)
+	val, err := json.Marshal(n)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
-
 	// 写服务信息
-	_, err = p.cli.Put(context.Background(), p.srvKey, string(addr), clientv3.WithLease(leaseResp.ID))
+	_, err = cli.Put(reqCtx, srvKey, string(val), clientv3.WithLease(leaseResp.ID))
 	if err != nil {
-		return err
+		p.revoke(leaseResp.ID)
+		return nil, 0, err
 	}
-	_, err = p.cli.KeepAlive(context.Background(), leaseResp.ID)
+	ch, err := cli.KeepAlive(ctx, leaseResp.ID)
+	if err != nil {
+		p.revoke(leaseResp.ID)
+		return nil, 0, err
+	}
+	p.Options.Logger.Infow("服务注册成功", "srvKey", srvKey, "lease", leaseResp.ID)
+	return ch, leaseResp.ID, nil
+}
+
+// 持续消费续期响应，租约丢失后重新注册，ch 为nil表示尚未注册成功
+// 取消注册只取消 ctx 不等待本协程退出，持有 mu 检查 ctx 后才更新租约，回调中可以调用 UnRegister
+func (p *EtcdV3) keepAlive(ctx context.Context, ch <-chan *clientv3.LeaseKeepAliveResponse, n *register.Node, srvKey string) {
+	for {
+		if ch != nil {
+			// 通道关闭表示租约过期、被删除或连接中断
+			for range ch {
+			}
+			p.mu.Lock()
+			if ctx.Err() != nil {
+				p.mu.Unlock()
+				return
+			}
+			// 租约已丢失，取消注册时无需撤销
+			lost := p.leaseID
+			p.leaseID = 0
+			p.mu.Unlock()
+			p.Options.Logger.Warnw("服务注册信息丢失，重新注册", "srvKey", srvKey, "lease", lost)
+			p.emit(n, register.RegisterStateLost, errors.New("租约续期中断"))
+		}
+		// 按退避策略重新注册
+		for attempt := 0; ; attempt++ {
+			select {
+			case <-time.After(backoff(attempt)):
+			case <-ctx.Done():
+				return
+			}
+			var id clientv3.LeaseID
+			var err error
+			ch, id, err = p.grantAndPut(ctx, n, srvKey)
+			if err != nil {
+				p.Options.Logger.Warnw("重新注册服务错误", "err", err, "srvKey", srvKey, "attempt", attempt)
+				continue
+			}
+			p.mu.Lock()
+			if ctx.Err() != nil {
+				// 重新注册期间已取消注册，撤销新租约
+				p.mu.Unlock()
+				p.revoke(id)
+				return
+			}
+			p.leaseID = id
+			p.mu.Unlock()
+			p.emit(n, register.RegisterStateRegistered, nil)
+			break
+		}
+	}
+}
+
+// 撤销租约，租约关联的注册信息同时删除
+func (p *EtcdV3) revoke(id clientv3.LeaseID) error {
+	cli, err := p.client()
 	if err != nil {
 		return err
 	}
-	return nil
+	ctx, cancel := context.WithTimeout(context.Background(), revokeTimeout)
+	defer cancel()
+	_, err = cli.Revoke(ctx, id)
+	return err
 }
 
-// UnRegister 取消注册一个服务
+// 通知注册状态变化，调用时不能持有 mu
+func (p *EtcdV3) emit(n *register.Node, state register.RegisterState, err error) {
+	if p.Options.OnRegisterEvent == nil {
+		return
+	}
+	p.Options.OnRegisterEvent(&register.RegisterEvent{
+		State: state,
+		Node:  n,
+		Err:   err,
+	})
+}
+
+// UnRegister 取消注册一个服务 - 停止续期并撤销租约
 func (p *EtcdV3) UnRegister(n *register.Node) error {
-	_, err := p.cli.Delete(context.Background(), p.srvKey)
+	p.mu.Lock()
+	if p.cancel == nil {
+		p.mu.Unlock()
+		return nil
+	}
+	p.cancel()
+	p.cancel = nil
+	node := p.node
+	srvKey := p.srvKey
+	id := p.leaseID
+	p.leaseID = 0
+	p.mu.Unlock()
+	// 从未注册成功或租约已丢失时无需撤销
+	if id == 0 {
+		p.emit(node, register.RegisterStateUnRegistered, nil)
+		return nil
+	}
+	err := p.revoke(id)
 	if err != nil {
-		p.Options.Logger.Warnw("删除服务注册信息错误", "err", err, "srvKey", p.srvKey)
+		p.Options.Logger.Warnw("撤销服务注册租约错误", "err", err, "srvKey", srvKey, "lease", id)
 	}
+	p.emit(node, register.RegisterStateUnRegistered, err)
 	return err
 }
 
@@ -149,21 +338,18 @@ func (p *EtcdV3) GetBuilder() resolver.Builder {
 	return p
 }
 
-// Build grpc resolver接口需要 - 创建一个服务注册中心中间件
-func (p *EtcdV3) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOption) (resolver.Resolver, error) {
-	var err error
-	if p.cli == nil {
-		// 创建etcd客户端对象
-		err = p.initEtcdCli()
-		if err != nil {
-			p.Options.Logger.Fatalw("连接etcd服务错误", "err", err, "addrs", p.Options.Addrs)
-			return nil, err
-		}
+// Build grpc resolver接口需要 - 为每个连接创建独立监听，解析器基于 Watch 实现
+// 服务名从连接地址获取 scheme://authority/{服务名}，未设置时使用 Options.Name
+func (p *EtcdV3) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	name := target.Endpoint
+	if name == "" {
+		name = p.Options.Name
 	}
-	p.cc = cc
-
-	go p.watch(p.keyPrefix(nil))
-	return p, nil
+	w, err := p.Watch(name)
+	if err != nil {
+		return nil, err
+	}
+	return register.NewWatchResolver(w, cc, p.Options.Logger), nil
 }
 
 // Scheme 相当于服务分类名 - 服务注册根路径
@@ -175,77 +361,8 @@ func (p *EtcdV3) Scheme() string {
 	return schema
 }
 
-// ResolveNow 什么也不做
-func (p *EtcdV3) ResolveNow(rn resolver.ResolveNowOption) {
-	// log.Println("ResolveNow")
-}
-
-// Close 关闭注册解析器
-func (p *EtcdV3) Close() {
-	p.Options.Logger.Infow("关闭etcd服务解析器")
-}
-
-// watch 监听服务变化
-func (p *EtcdV3) watch(keyPrefix string) {
-	var addrList []resolver.Address
-	getResp, err := p.cli.Get(context.Background(), keyPrefix, clientv3.WithPrefix())
-	if err != nil {
-		p.Options.Logger.Errorw("监听服务变化错误", "err", err, "keyPrefix", keyPrefix)
-	} else {
-		for _, kv := range getResp.Kvs {
-			sn := new(register.Node)
-			err = json.Unmarshal(kv.Value, sn)
-			addrList = append(addrList, resolver.Address{Addr: sn.Advertise})
-		}
-	}
-	p.cc.NewAddress(addrList)
-	rch := p.cli.Watch(context.Background(), keyPrefix, clientv3.WithPrefix())
-	for n := range rch {
-		for _, ev := range n.Events {
-			// 解析服务注册的地址信息
-			sn := new(register.Node)
-			err = json.Unmarshal(ev.Kv.Value, sn)
-			if err != nil {
-				p.Options.Logger.Errorw("服务注册信息解析错误", "err", err, "key", string(ev.Kv.Key), "value", string(ev.Kv.Value))
-				continue
-			}
-			// 客户端发现地址
-			addr := sn.Advertise
-
-			switch ev.Type {
-			case mvccpb.PUT:
-				if !exist(addrList, addr) {
-					addrList = append(addrList, resolver.Address{Addr: addr})
-					p.cc.NewAddress(addrList)
-				}
-			case mvccpb.DELETE:
-				if s, ok := remove(addrList, addr); ok {
-					addrList = s
-					p.cc.NewAddress(addrList)
-				}
-			}
-			p.Options.Logger.Infow("监听到etcd服务变化", "type", ev.Type, "key", string(ev.Kv.Key), "value", string(ev.Kv.Value))
-		}
-	}
-}
-
-// 解析器是否已存在
-func exist(l []resolver.Address, addr string) bool {
-	for i := range l {
-		if l[i].Addr == addr {
-			return true
-		}
-	}
-	return false
-}
+// ResolveNow 什么也不做 - 每个连接的解析器由 Build 创建
+func (p *EtcdV3) ResolveNow(rn resolver.ResolveNowOptions) {}
 
-// 删除解析器
-func remove(s []resolver.Address, addr string) ([]resolver.Address, bool) {
-	for i := range s {
-		if s[i].Addr == addr {
-			s[i] = s[len(s)-1]
-			return s[:len(s)-1], true
-		}
-	}
-	return nil, false
-}
+// Close 什么也不做 - 每个连接的解析器由 Build 创建
+func (p *EtcdV3) Close() {}
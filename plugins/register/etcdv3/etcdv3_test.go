@@ -0,0 +1,305 @@
+package etcdv3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/micro-kit/microkit/plugins/register"
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/embed"
+	"go.etcd.io/etcd/etcdserver/api/v3rpc/rpctypes"
+)
+
+const (
+	// 测试etcd地址，不使用默认端口，避免影响本机etcd
+	testClientURL = "http://127.0.0.1:23790"
+	testPeerURL   = "http://127.0.0.1:23800"
+)
+
+// 测试用etcd地址
+var testEndpoint = strings.TrimPrefix(testClientURL, "http://")
+
+// 启动进程内etcd，包内全部测试共用，每个测试使用独立的命名空间
+func TestMain(m *testing.M) {
+	// etcd不可用的测试不等待默认连接超时，开启认证时获取token较慢
+	dialTimeout = 3 * time.Second
+	dir, err := ioutil.TempDir("", "microkit-etcd")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LogLevel = "error"
+	clientURL, _ := url.Parse(testClientURL)
+	peerURL, _ := url.Parse(testPeerURL)
+	cfg.LCUrls, cfg.ACUrls = []url.URL{*clientURL}, []url.URL{*clientURL}
+	cfg.LPUrls, cfg.APUrls = []url.URL{*peerURL}, []url.URL{*peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		fmt.Println(err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		fmt.Println("启动etcd超时")
+		e.Close()
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	code := m.Run()
+	e.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// 测试命名空间
+func testNamespace(t *testing.T) string {
+	return strings.Replace(t.Name(), "/", "_", -1)
+}
+
+// 创建连接测试etcd的注册中间件，使用测试命名空间
+func newTestRegistry(t *testing.T, ops ...register.Option) *EtcdV3 {
+	t.Helper()
+	defaults := []register.Option{
+		register.Addrs(testEndpoint),
+		register.Schema(testNamespace(t)),
+		register.Name("svc"),
+	}
+	reg, err := NewRegistry(append(defaults, ops...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg.(*EtcdV3)
+}
+
+// 创建测试用etcd客户端
+func newTestClient(t *testing.T) *clientv3.Client {
+	t.Helper()
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{testEndpoint},
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cli
+}
+
+// 读取key对应的节点和租约，key不存在时返回nil
+func getNode(t *testing.T, cli *clientv3.Client, key string) (*register.Node, clientv3.LeaseID) {
+	t.Helper()
+	resp, err := cli.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, 0
+	}
+	n := new(register.Node)
+	if err := json.Unmarshal(resp.Kvs[0].Value, n); err != nil {
+		t.Fatal(err)
+	}
+	return n, clientv3.LeaseID(resp.Kvs[0].Lease)
+}
+
+// 记录注册状态变化
+type stateRecorder chan *register.RegisterEvent
+
+func (r stateRecorder) record(ev *register.RegisterEvent) {
+	r <- ev
+}
+
+// 等待下一个注册状态
+func (r stateRecorder) wait(t *testing.T, want register.RegisterState) *register.RegisterEvent {
+	t.Helper()
+	select {
+	case ev := <-r:
+		if ev.State != want {
+			t.Fatalf("注册状态 = %s (err %v), want %s", ev.State, ev.Err, want)
+		}
+		return ev
+	case <-time.After(10 * time.Second):
+		t.Fatalf("等待注册状态 %s 超时", want)
+	}
+	return nil
+}
+
+func TestRegisterUnRegister(t *testing.T) {
+	states := make(stateRecorder, 16)
+	reg := newTestRegistry(t, register.OnRegisterEvent(states.record))
+	cli := newTestClient(t)
+	defer cli.Close()
+
+	node := &register.Node{Id: "n1", Address: "127.0.0.1:1", Metadata: map[string]string{"k": "v"}}
+	if err := reg.Register(node); err != nil {
+		t.Fatal(err)
+	}
+	states.wait(t, register.RegisterStateRegistered)
+	key := reg.keyPrefix(node)
+	got, lease := getNode(t, cli, key)
+	if got == nil || got.Address != node.Address || got.Metadata["k"] != "v" {
+		t.Fatalf("注册信息 = %+v, want %+v", got, node)
+	}
+	if lease == 0 {
+		t.Error("注册信息未关联租约")
+	}
+	if err := reg.Register(node); err == nil {
+		t.Error("重复 Register() 未返回错误")
+	}
+
+	if err := reg.UnRegister(node); err != nil {
+		t.Fatal(err)
+	}
+	states.wait(t, register.RegisterStateUnRegistered)
+	if got, _ := getNode(t, cli, key); got != nil {
+		t.Errorf("取消注册后注册信息仍然存在 %+v", got)
+	}
+	// 重复取消注册直接返回
+	if err := reg.UnRegister(node); err != nil {
+		t.Errorf("重复 UnRegister() error = %v", err)
+	}
+}
+
+func TestLeaseReRegister(t *testing.T) {
+	states := make(stateRecorder, 16)
+	reg := newTestRegistry(t, register.OnRegisterEvent(states.record))
+	cli := newTestClient(t)
+	defer cli.Close()
+
+	node := &register.Node{Id: "n1", Address: "127.0.0.1:1"}
+	if err := reg.Register(node); err != nil {
+		t.Fatal(err)
+	}
+	defer reg.UnRegister(node)
+	states.wait(t, register.RegisterStateRegistered)
+	key := reg.keyPrefix(node)
+	_, lease := getNode(t, cli, key)
+
+	// 租约被删除后重新注册
+	if _, err := cli.Revoke(context.Background(), lease); err != nil {
+		t.Fatal(err)
+	}
+	states.wait(t, register.RegisterStateLost)
+	states.wait(t, register.RegisterStateRegistered)
+	got, newLease := getNode(t, cli, key)
+	if got == nil {
+		t.Fatal("重新注册后注册信息不存在")
+	}
+	if newLease == lease {
+		t.Error("重新注册未使用新租约")
+	}
+	reg.mu.Lock()
+	current := reg.leaseID
+	reg.mu.Unlock()
+	if current != newLease {
+		t.Errorf("当前租约 = %x, want %x", current, newLease)
+	}
+}
+
+func TestCallbackUnRegister(t *testing.T) {
+	var reg *EtcdV3
+	done := make(chan struct{})
+	// 回调中取消注册不会死锁
+	reg = newTestRegistry(t, register.OnRegisterEvent(func(ev *register.RegisterEvent) {
+		switch ev.State {
+		case register.RegisterStateRegistered:
+			reg.UnRegister(ev.Node)
+		case register.RegisterStateUnRegistered:
+			close(done)
+		}
+	}))
+	if err := reg.Register(&register.Node{Id: "n1", Address: "127.0.0.1:1"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("回调中取消注册未完成")
+	}
+}
+
+// 开启etcd认证，返回关闭认证的函数
+func enableAuth(t *testing.T, cli *clientv3.Client, password string) func() {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := cli.RoleAdd(ctx, "root"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.UserAdd(ctx, "root", password); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.UserGrantRole(ctx, "root", "root"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.AuthEnable(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		root, err := clientv3.New(clientv3.Config{
+			Endpoints:   []string{testEndpoint},
+			DialTimeout: 5 * time.Second,
+			Username:    "root",
+			Password:    password,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer root.Close()
+		if _, err := root.AuthDisable(ctx); err != nil {
+			t.Fatal(err)
+		}
+		root.UserDelete(ctx, "root")
+		root.RoleDelete(ctx, "root")
+	}
+}
+
+func TestAuth(t *testing.T) {
+	cli := newTestClient(t)
+	defer cli.Close()
+	defer enableAuth(t, cli, "secret")()
+
+	if _, err := NewRegistry(register.Addrs(testEndpoint), register.Auth("root", "wrong")); err != rpctypes.ErrAuthFailed {
+		t.Errorf("密码错误时 NewRegistry() error = %v, want %v", err, rpctypes.ErrAuthFailed)
+	}
+	reg := newTestRegistry(t, register.Auth("root", "secret"))
+	node := &register.Node{Id: "n1", Address: "127.0.0.1:1"}
+	if err := reg.Register(node); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.UnRegister(node); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewRegistryUnreachable(t *testing.T) {
+	if _, err := NewRegistry(register.Addrs("127.0.0.1:1")); err == nil {
+		t.Error("etcd不可用时 NewRegistry() 未返回错误")
+	}
+}
+
+func TestLazyConnect(t *testing.T) {
+	states := make(stateRecorder, 16)
+	reg := newTestRegistry(t, register.Addrs("127.0.0.1:1"), register.LazyConnect(true), register.OnRegisterEvent(states.record))
+	// etcd不可用时注册不返回错误，在后台持续重试
+	node := &register.Node{Id: "n1", Address: "127.0.0.1:1"}
+	if err := reg.Register(node); err != nil {
+		t.Fatal(err)
+	}
+	if ev := states.wait(t, register.RegisterStateLost); ev.Err == nil {
+		t.Error("注册失败事件未包含错误")
+	}
+	if err := reg.UnRegister(node); err != nil {
+		t.Errorf("UnRegister() error = %v", err)
+	}
+}
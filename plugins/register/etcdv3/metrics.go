@@ -0,0 +1,35 @@
+package etcdv3
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+/* 服务发现监控指标 */
+
+var (
+	// 解析器与etcd断开连接，正在使用旧的服务地址
+	resolverStale = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "microkit",
+		Subsystem: "etcd_resolver",
+		Name:      "stale",
+		Help:      "Whether the etcd resolver lost its connection to etcd and is serving stale endpoints (1) or not (0).",
+	}, []string{"service", "prefix"})
+	// 解析器重新获取全部服务地址次数
+	resolverRelists = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "microkit",
+		Subsystem: "etcd_resolver",
+		Name:      "relists_total",
+		Help:      "Total number of full re-lists performed by the etcd resolver.",
+	}, []string{"service", "prefix", "reason"})
+	// 解析器正在使用本地快照中的服务地址
+	resolverSnapshot = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "microkit",
+		Subsystem: "etcd_resolver",
+		Name:      "snapshot",
+		Help:      "Whether the etcd resolver is serving endpoints seeded from the local snapshot file (1) or not (0).",
+	}, []string{"service", "prefix"})
+)
+
+func init() {
+	prometheus.MustRegister(resolverStale, resolverRelists, resolverSnapshot)
+}
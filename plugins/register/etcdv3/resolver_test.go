@@ -0,0 +1,171 @@
+package etcdv3
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/micro-kit/microkit/plugins/register"
+	"go.etcd.io/etcd/clientv3"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// 测试用客户端连接，记录推送的地址列表
+type testClientConn struct {
+	states chan resolver.State
+}
+
+func newTestClientConn() *testClientConn {
+	return &testClientConn{states: make(chan resolver.State, 64)}
+}
+
+func (cc *testClientConn) UpdateState(s resolver.State)                         { cc.states <- s }
+func (cc *testClientConn) ReportError(error)                                    {}
+func (cc *testClientConn) NewAddress([]resolver.Address)                        {}
+func (cc *testClientConn) NewServiceConfig(string)                              {}
+func (cc *testClientConn) ParseServiceConfig(string) *serviceconfig.ParseResult { return nil }
+
+// 等待推送的节点列表为 want，节点按 id:metadata v 排序拼接
+func (cc *testClientConn) waitNodes(t *testing.T, want string) []*register.Node {
+	t.Helper()
+	timeout := time.After(10 * time.Second)
+	got := ""
+	for {
+		select {
+		case s := <-cc.states:
+			var nodes []*register.Node
+			var ids []string
+			for _, addr := range s.Addresses {
+				n, ok := register.NodeFromAddress(addr)
+				if !ok {
+					t.Fatalf("地址 %s 未携带节点信息", addr.Addr)
+				}
+				nodes = append(nodes, n)
+				ids = append(ids, n.Id+":"+n.Metadata["v"])
+			}
+			sort.Strings(ids)
+			got = strings.Join(ids, ",")
+			if got == want {
+				return nodes
+			}
+		case <-timeout:
+			t.Fatalf("推送节点列表 %q, want %q", got, want)
+		}
+	}
+}
+
+// 注册节点，metadata v 为 version
+func registerNode(t *testing.T, id, version string, ops ...register.Option) *EtcdV3 {
+	t.Helper()
+	reg := newTestRegistry(t, ops...)
+	n := &register.Node{Id: id, Address: id + ":1", Metadata: map[string]string{"v": version}}
+	if err := reg.Register(n); err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+func TestResolverTracksKeys(t *testing.T) {
+	cli := newTestClient(t)
+	defer cli.Close()
+	a := registerNode(t, "a", "1")
+	defer a.UnRegister(nil)
+	b := registerNode(t, "b", "1")
+	defer b.UnRegister(nil)
+
+	cc := newTestClientConn()
+	r, err := newTestRegistry(t).Build(resolver.Target{Endpoint: "svc"}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	cc.waitNodes(t, "a:1,b:1")
+
+	// 注册信息变化时更新节点
+	key := a.keyPrefix(&register.Node{Id: "a"})
+	val, _ := json.Marshal(&register.Node{Id: "a", Address: "a:1", Metadata: map[string]string{"v": "2"}})
+	if _, err := cli.Put(context.Background(), key, string(val), clientv3.WithIgnoreLease()); err != nil {
+		t.Fatal(err)
+	}
+	cc.waitNodes(t, "a:2,b:1")
+
+	// DELETE 事件不包含注册信息，按key删除节点
+	if err := b.UnRegister(nil); err != nil {
+		t.Fatal(err)
+	}
+	cc.waitNodes(t, "a:2")
+}
+
+func TestNamespaceIsolation(t *testing.T) {
+	dev, staging := testNamespace(t)+"-dev", testNamespace(t)+"-staging"
+	a := registerNode(t, "a", "1", register.Schema(dev))
+	defer a.UnRegister(nil)
+	b := registerNode(t, "b", "1", register.Schema(staging))
+	defer b.UnRegister(nil)
+	if key := a.keyPrefix(&register.Node{Id: "a"}); key != "microkit/"+dev+"/services/svc/a" {
+		t.Errorf("注册key = %s, want microkit/%s/services/svc/a", key, dev)
+	}
+
+	// 只发现本命名空间的节点
+	cc := newTestClientConn()
+	r, err := newTestRegistry(t, register.Schema(dev)).Build(resolver.Target{Endpoint: "svc"}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	cc.waitNodes(t, "a:1")
+
+	// 显式设置后发现其它命名空间的节点
+	cross := newTestClientConn()
+	r, err = newTestRegistry(t, register.Schema(dev), register.DiscoverNamespaces(staging)).
+		Build(resolver.Target{Endpoint: "svc"}, cross, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	cross.waitNodes(t, "a:1,b:1")
+}
+
+func TestResolverPerTarget(t *testing.T) {
+	a := registerNode(t, "a", "1")
+	defer a.UnRegister(nil)
+	o := registerNode(t, "o", "1", register.Name("other"))
+	defer o.UnRegister(nil)
+
+	// 同一个注册中间件按 target 解析不同服务
+	reg := newTestRegistry(t)
+	build := func(endpoint string) (*testClientConn, resolver.Resolver) {
+		cc := newTestClientConn()
+		r, err := reg.Build(resolver.Target{Endpoint: endpoint}, cc, resolver.BuildOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cc, r
+	}
+	svcCC, svc := build("svc")
+	defer svc.Close()
+	otherCC, other := build("other")
+	svcCC.waitNodes(t, "a:1")
+	otherCC.waitNodes(t, "o:1")
+	// 未设置 target 时解析本服务
+	defaultCC, def := build("")
+	defer def.Close()
+	defaultCC.waitNodes(t, "a:1")
+
+	// 关闭后停止监听，不影响其它解析器
+	other.Close()
+	p := registerNode(t, "p", "1", register.Name("other"))
+	defer p.UnRegister(nil)
+	b := registerNode(t, "b", "1")
+	defer b.UnRegister(nil)
+	svcCC.waitNodes(t, "a:1,b:1")
+	select {
+	case s := <-otherCC.states:
+		t.Errorf("关闭后仍然推送地址 %v", s.Addresses)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,98 @@
+package etcdv3
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/micro-kit/microkit/plugins/register"
+)
+
+/*
+ 服务节点快照
+ 客户端发现的服务节点写入本地文件，etcd不可用时使用最后一次发现的服务节点
+ 文件按 命名空间_服务名 区分，写入临时文件后重命名，避免读到写了一半的文件
+*/
+
+// 服务节点快照文件内容
+type snapshot struct {
+	Service   string                    `json:"service"`
+	UpdatedAt time.Time                 `json:"updated_at"`
+	Nodes     map[string]*register.Node `json:"nodes"` // etcd key -> 节点
+	seq       uint64                    // 快照序号，用于丢弃比已写入快照更旧的快照
+}
+
+// 获取服务快照的写入权，没有监听负责写入时由当前监听负责
+func (p *EtcdV3) ownSnapshot(name string, w *etcdWatcher) bool {
+	p.snapMu.Lock()
+	defer p.snapMu.Unlock()
+	owner, ok := p.snapOwners[name]
+	if !ok {
+		if p.snapOwners == nil {
+			p.snapOwners = make(map[string]*etcdWatcher)
+		}
+		p.snapOwners[name] = w
+		return true
+	}
+	return owner == w
+}
+
+// 监听停止时释放服务快照的写入权，由其它监听在下次节点变化时接替
+func (p *EtcdV3) releaseSnapshot(name string, w *etcdWatcher) {
+	p.snapMu.Lock()
+	defer p.snapMu.Unlock()
+	if p.snapOwners[name] == w {
+		delete(p.snapOwners, name)
+	}
+}
+
+// 服务快照文件路径
+func (p *EtcdV3) snapshotFile(name string) string {
+	return filepath.Join(p.Options.SnapshotDir, url.PathEscape(p.Scheme()+"_"+name)+".json")
+}
+
+// 写入快照文件
+func writeSnapshot(file string, ss *snapshot) error {
+	data, err := json.Marshal(ss)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(file)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, ".snapshot-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// 读取快照文件
+func readSnapshot(file string) (*snapshot, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	ss := new(snapshot)
+	err = json.Unmarshal(data, ss)
+	if err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
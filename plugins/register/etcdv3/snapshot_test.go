@@ -0,0 +1,112 @@
+package etcdv3
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/micro-kit/microkit/plugins/register"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// 快照文件中是否包含节点
+func snapshotHas(reg *EtcdV3, name, id string) bool {
+	ss, err := readSnapshot(reg.snapshotFile(name))
+	if err != nil {
+		return false
+	}
+	for _, sn := range ss.Nodes {
+		if sn.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// 当前负责写入快照的监听
+func snapshotOwner(reg *EtcdV3, name string) *etcdWatcher {
+	reg.snapMu.Lock()
+	defer reg.snapMu.Unlock()
+	return reg.snapOwners[name]
+}
+
+func TestSnapshotSeed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "microkit-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a := registerNode(t, "a", "1")
+	defer a.UnRegister(nil)
+
+	// 发现的节点写入快照文件
+	reg := newTestRegistry(t, register.SnapshotDir(dir))
+	w, err := reg.Watch("svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantEvent(t, w, register.EventAdd, "a")
+	wantEvent(t, w, register.EventSynced, "")
+	eventually(t, "快照文件未包含节点 a", func() bool { return snapshotHas(reg, "svc", "a") })
+	w.Stop()
+
+	// etcd不可用时使用快照中的节点完成同步
+	lazy := newTestRegistry(t, register.Addrs("127.0.0.1:1"), register.LazyConnect(true), register.SnapshotDir(dir))
+	w, err = lazy.Watch("svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	wantEvent(t, w, register.EventAdd, "a")
+	wantEvent(t, w, register.EventSynced, "")
+	prefix := lazy.discoverPrefixes("svc")[0]
+	if v := testutil.ToFloat64(resolverSnapshot.WithLabelValues("svc", prefix)); v != 1 {
+		t.Errorf("snapshot = %v, want 1", v)
+	}
+	if v := testutil.ToFloat64(resolverStale.WithLabelValues("svc", prefix)); v != 1 {
+		t.Errorf("stale = %v, want 1", v)
+	}
+}
+
+func TestSnapshotSingleOwner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "microkit-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a := registerNode(t, "a", "1")
+	defer a.UnRegister(nil)
+
+	reg := newTestRegistry(t, register.SnapshotDir(dir))
+	watchers := make(map[*etcdWatcher]bool)
+	for i := 0; i < 2; i++ {
+		w, err := reg.Watch("svc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Stop()
+		wantEvent(t, w, register.EventAdd, "a")
+		wantEvent(t, w, register.EventSynced, "")
+		watchers[w.(*etcdWatcher)] = true
+	}
+	// 同一服务只由一个监听写入快照
+	owner := snapshotOwner(reg, "svc")
+	if !watchers[owner] {
+		t.Fatalf("快照写入监听 = %p, want 本服务的监听", owner)
+	}
+	delete(watchers, owner)
+	var other *etcdWatcher
+	for w := range watchers {
+		other = w
+	}
+
+	// 写入监听停止后由其它监听接替
+	owner.Stop()
+	b := registerNode(t, "b", "1")
+	defer b.UnRegister(nil)
+	wantEvent(t, other, register.EventAdd, "b")
+	eventually(t, "快照文件未包含节点 b", func() bool { return snapshotHas(reg, "svc", "b") })
+	if got := snapshotOwner(reg, "svc"); got != other {
+		t.Errorf("快照写入监听 = %p, want %p", got, other)
+	}
+}
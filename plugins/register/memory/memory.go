@@ -0,0 +1,254 @@
+package memory
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/micro-kit/microkit/plugins/register"
+	"google.golang.org/grpc/resolver"
+)
+
+/*
+ 进程内服务注册中间件
+ 同一进程内的服务端和客户端通过共享存储互相发现，用于单元测试和单进程部署
+ 相同 Schema 和服务名的注册信息互相可见
+*/
+
+const (
+	// 默认 schema
+	defaultSchema = "memory"
+)
+
+var (
+	// 进程内共享存储
+	defaultStore = newStore()
+)
+
+// Memory 进程内服务注册中间件
+type Memory struct {
+	Options *register.Options // 注册服务配置
+	store   *store
+}
+
+// NewRegistry 创建一个进程内服务注册中间件
+func NewRegistry(ops ...register.Option) register.Register {
+	m := &Memory{
+		Options: new(register.Options),
+		store:   defaultStore,
+	}
+	for _, o := range ops {
+		o(m.Options)
+	}
+	if m.Options.Schema == "" {
+		m.Options.Schema = defaultSchema
+	}
+	return m
+}
+
+// 服务存储key - schema/服务名
+func (m *Memory) serviceKey(name string) string {
+	return m.Options.Schema + "/" + name
+}
+
+// Register 注册一个服务
+func (m *Memory) Register(n *register.Node) error {
+	if n == nil {
+		return errors.New("服务注册信息不能为nil")
+	}
+	m.store.put(m.serviceKey(m.Options.Name), n)
+	return nil
+}
+
+// UnRegister 取消注册一个服务
+func (m *Memory) UnRegister(n *register.Node) error {
+	if n == nil {
+		return errors.New("服务注册信息不能为nil")
+	}
+	m.store.delete(m.serviceKey(m.Options.Name), n.Id)
+	return nil
+}
+
+// GetResolver 获取客户端发现 grpc Resolver对象 - 每个连接的解析器由 Build 创建
+func (m *Memory) GetResolver() resolver.Resolver {
+	return m
+}
+
+// GetBuilder 获取grpc服务注册Builder对象
+func (m *Memory) GetBuilder() resolver.Builder {
+	return m
+}
+
+// Build grpc resolver接口需要 - 为每个连接创建一个独立的解析器
+func (m *Memory) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	name := target.Endpoint
+	if name == "" {
+		name = m.Options.Name
+	}
+	r := &memoryResolver{
+		store:  m.store,
+		key:    m.serviceKey(name),
+		cc:     cc,
+		addrs:  register.NewAddressCache(),
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	m.store.watch(r.key, r)
+	r.trigger()
+	go r.run()
+	return r, nil
+}
+
+// Scheme 相当于服务分类名
+func (m *Memory) Scheme() string {
+	return m.Options.Schema
+}
+
+// ResolveNow 什么也不做
+func (m *Memory) ResolveNow(rn resolver.ResolveNowOptions) {}
+
+// Close 什么也不做
+func (m *Memory) Close() {}
+
+// 进程内共享存储
+type store struct {
+	mu       sync.RWMutex
+	services map[string]map[string]*register.Node    // 服务key -> 节点id -> 节点
+	watchers map[string]map[*memoryResolver]struct{} // 服务key -> 监听者
+}
+
+// 创建存储
+func newStore() *store {
+	return &store{
+		services: make(map[string]map[string]*register.Node),
+		watchers: make(map[string]map[*memoryResolver]struct{}),
+	}
+}
+
+// 写入节点并通知监听者
+func (s *store) put(key string, n *register.Node) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nodes, ok := s.services[key]
+	if !ok {
+		nodes = make(map[string]*register.Node)
+		s.services[key] = nodes
+	}
+	nodes[n.Id] = n
+	s.notifyLocked(key)
+}
+
+// 删除节点并通知监听者
+func (s *store) delete(key, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nodes, ok := s.services[key]
+	if !ok {
+		return
+	}
+	delete(nodes, id)
+	if len(nodes) == 0 {
+		delete(s.services, key)
+	}
+	s.notifyLocked(key)
+}
+
+// 获取服务全部节点，按节点id排序
+func (s *store) list(key string) []*register.Node {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	nodes := make([]*register.Node, 0, len(s.services[key]))
+	for _, n := range s.services[key] {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Id < nodes[j].Id
+	})
+	return nodes
+}
+
+// 添加监听者
+func (s *store) watch(key string, r *memoryResolver) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ws, ok := s.watchers[key]
+	if !ok {
+		ws = make(map[*memoryResolver]struct{})
+		s.watchers[key] = ws
+	}
+	ws[r] = struct{}{}
+}
+
+// 删除监听者
+func (s *store) unwatch(key string, r *memoryResolver) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.watchers[key], r)
+	if len(s.watchers[key]) == 0 {
+		delete(s.watchers, key)
+	}
+}
+
+// 通知监听者服务节点变化
+func (s *store) notifyLocked(key string) {
+	for r := range s.watchers[key] {
+		r.trigger()
+	}
+}
+
+// 单个连接的解析器
+type memoryResolver struct {
+	store     *store
+	key       string
+	cc        resolver.ClientConn
+	addrs     *register.AddressCache // 节点id -> 地址，节点不变时复用
+	pushed    bool                   // 是否已推送过地址列表
+	notify    chan struct{}          // 节点变化通知，合并多次通知
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// 触发更新
+func (r *memoryResolver) trigger() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// 收到通知后推送最新节点列表
+func (r *memoryResolver) run() {
+	for {
+		select {
+		case <-r.notify:
+			r.update()
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// 节点列表变化时推送，未变化的节点使用缓存的地址
+func (r *memoryResolver) update() {
+	nodes := make(map[string]*register.Node)
+	for _, n := range r.store.list(r.key) {
+		nodes[n.Id] = n
+	}
+	addrs, changed := r.addrs.Update(nodes)
+	if !changed && r.pushed {
+		return
+	}
+	r.pushed = true
+	r.cc.UpdateState(resolver.State{Addresses: addrs})
+}
+
+// ResolveNow 什么也不做 - 节点变化时存储主动通知，连接失败时重新推送相同地址没有意义
+func (r *memoryResolver) ResolveNow(rn resolver.ResolveNowOptions) {}
+
+// Close 停止监听
+func (r *memoryResolver) Close() {
+	r.closeOnce.Do(func() {
+		r.store.unwatch(r.key, r)
+		close(r.done)
+	})
+}
@@ -0,0 +1,98 @@
+package memory
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/micro-kit/microkit/plugins/register"
+	"google.golang.org/grpc/resolver"
+)
+
+// 测试用客户端连接，记录推送的地址列表
+type testClientConn struct {
+	resolver.ClientConn
+	states chan resolver.State
+}
+
+func (cc *testClientConn) UpdateState(s resolver.State) {
+	cc.states <- s
+}
+
+// 等待推送指定节点列表
+func waitNodes(t *testing.T, cc *testClientConn, want string) resolver.State {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case s := <-cc.states:
+			var ids []string
+			for _, addr := range s.Addresses {
+				n, ok := register.NodeFromAddress(addr)
+				if !ok {
+					t.Fatalf("地址 %s 未携带节点信息", addr.Addr)
+				}
+				ids = append(ids, n.Id)
+			}
+			sort.Strings(ids)
+			if strings.Join(ids, ",") == want {
+				return s
+			}
+		case <-timeout:
+			t.Fatalf("等待节点列表 %q 超时", want)
+		}
+	}
+}
+
+// 确认没有推送
+func expectNoUpdate(t *testing.T, cc *testClientConn) {
+	t.Helper()
+	select {
+	case s := <-cc.states:
+		t.Fatalf("节点未变化时推送了地址列表 %v", s.Addresses)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestResolver(t *testing.T) {
+	m := NewRegistry(register.Name("svc"), register.Schema("memory-test-resolver"))
+	cc := &testClientConn{states: make(chan resolver.State, 16)}
+	r, err := m.GetBuilder().Build(resolver.Target{Endpoint: "svc"}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	// 没有节点时也推送一次
+	waitNodes(t, cc, "")
+
+	a := &register.Node{Id: "a", Address: "127.0.0.1:1"}
+	b := &register.Node{Id: "b", Address: "127.0.0.1:2"}
+	m.Register(a)
+	waitNodes(t, cc, "a")
+	m.Register(b)
+	s := waitNodes(t, cc, "a,b")
+	attrs := s.Addresses[0].Attributes
+
+	// 节点信息不变时不推送
+	m.Register(&register.Node{Id: "a", Address: "127.0.0.1:1"})
+	expectNoUpdate(t, cc)
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	expectNoUpdate(t, cc)
+
+	// 删除节点，未变化的节点复用地址
+	m.UnRegister(b)
+	s = waitNodes(t, cc, "a")
+	if s.Addresses[0].Attributes != attrs {
+		t.Error("节点 a 未变化但地址重新创建")
+	}
+
+	// 节点信息变化时重新创建地址
+	m.Register(&register.Node{Id: "a", Address: "127.0.0.1:3"})
+	s = waitNodes(t, cc, "a")
+	if s.Addresses[0].Addr != "127.0.0.1:3" {
+		t.Errorf("节点 a 地址 = %s, want 127.0.0.1:3", s.Addresses[0].Addr)
+	}
+	m.UnRegister(a)
+	waitNodes(t, cc, "")
+}
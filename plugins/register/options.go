@@ -2,6 +2,7 @@ package register
 
 import (
 	"crypto/tls"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -19,7 +20,17 @@ type Options struct {
 	TTL       int64       // 注册信息生存有效期
 	Secure    bool        // 是否启用安全连接
 	TLSConfig *tls.Config // tls加密连接配置
+	Username  string      // 服务注册中间件认证用户名
+	Password  string      // 服务注册中间件认证密码
 	Logger    *zap.SugaredLogger
+
+	DiscoverNamespaces []string // 额外发现的命名空间(Schema)，默认只发现本命名空间的服务
+	LazyConnect        bool     // 延迟连接，服务注册中间件不可用时不返回错误，在后台持续重试连接和注册
+	SnapshotDir        string   // 服务节点快照目录，设置后发现的服务节点写入本地文件，服务注册中间件不可用时使用快照
+
+	RefreshInterval time.Duration        // 定时刷新服务列表间隔，用于不支持监听的服务发现
+	DefaultPort     int                  // 服务地址未包含端口时使用的端口，用于DNS服务发现
+	OnRegisterEvent func(*RegisterEvent) // 服务注册状态变化回调
 }
 
 // Addrs 服务注册中间件地址
@@ -43,6 +54,14 @@ func TLSConfig(t *tls.Config) Option {
 	}
 }
 
+// Auth 服务注册中间件认证用户名和密码
+func Auth(username, password string) Option {
+	return func(o *Options) {
+		o.Username = username
+		o.Password = password
+	}
+}
+
 // TTL 注册信息生存有效期
 func TTL(t int64) Option {
 	return func(o *Options) {
@@ -64,9 +83,51 @@ func Schema(s string) Option {
 	}
 }
 
+// DiscoverNamespaces 额外发现其它命名空间(Schema)注册的服务，用于跨命名空间调用
+func DiscoverNamespaces(namespaces ...string) Option {
+	return func(o *Options) {
+		o.DiscoverNamespaces = namespaces
+	}
+}
+
+// LazyConnect 延迟连接，服务注册中间件不可用时服务仍可启动，在后台持续重试连接和注册
+func LazyConnect(b bool) Option {
+	return func(o *Options) {
+		o.LazyConnect = b
+	}
+}
+
+// SnapshotDir 服务节点快照目录，服务注册中间件不可用时使用最后一次发现的服务节点
+func SnapshotDir(dir string) Option {
+	return func(o *Options) {
+		o.SnapshotDir = dir
+	}
+}
+
 // Logger 设置日志对象
 func Logger(logger *zap.SugaredLogger) Option {
 	return func(o *Options) {
 		o.Logger = logger
 	}
 }
+
+// RefreshInterval 定时刷新服务列表间隔
+func RefreshInterval(d time.Duration) Option {
+	return func(o *Options) {
+		o.RefreshInterval = d
+	}
+}
+
+// DefaultPort 服务地址未包含端口时使用的端口
+func DefaultPort(port int) Option {
+	return func(o *Options) {
+		o.DefaultPort = port
+	}
+}
+
+// OnRegisterEvent 服务注册状态变化回调
+func OnRegisterEvent(f func(*RegisterEvent)) Option {
+	return func(o *Options) {
+		o.OnRegisterEvent = f
+	}
+}
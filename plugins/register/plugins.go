@@ -19,5 +19,36 @@ type Node struct {
 	Id        string            `json:"id"`        // 服务id
 	Address   string            `json:"address"`   // 服务地址ip或域名+端口
 	Advertise string            `json:"advertise"` // 服务注册发现地址
-	Metadata  map[string]string `json:"metadata"`  // 服务注册附加信息，可以是系统资源信息 - TODO 当前采用轮训(grpc.WithBalancerName("round_robin"))后期可在此字段做文章
+	Metadata  map[string]string `json:"metadata"`  // 服务注册附加信息，客户端负载均衡器根据附加信息选择节点
+}
+
+// 服务注册附加信息key
+const (
+	// MetadataWeight 节点权重，正整数，默认为1
+	MetadataWeight = "weight"
+	// MetadataZone 节点所在可用区
+	MetadataZone = "zone"
+	// MetadataRegion 节点所在地域
+	MetadataRegion = "region"
+	// MetadataVersion 节点服务版本，用于按版本路由
+	MetadataVersion = "version"
+)
+
+// RegisterState 服务注册状态
+type RegisterState string
+
+const (
+	// RegisterStateRegistered 注册成功
+	RegisterStateRegistered RegisterState = "registered"
+	// RegisterStateLost 注册信息丢失，正在重新注册
+	RegisterStateLost RegisterState = "lost"
+	// RegisterStateUnRegistered 已取消注册
+	RegisterStateUnRegistered RegisterState = "unregistered"
+)
+
+// RegisterEvent 服务注册状态变化事件
+type RegisterEvent struct {
+	State RegisterState // 注册状态
+	Node  *Node         // 注册节点
+	Err   error         // 导致状态变化的错误
 }
@@ -0,0 +1,136 @@
+package register
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/resolver"
+)
+
+/*
+ 基于服务节点变化监听的grpc解析器
+ 收到首次同步完成事件后即使没有节点也推送地址列表，避免调用一直等待解析结果
+ 监听返回错误时通知连接并等待后继续监听，只在监听停止后退出
+*/
+
+const (
+	// 监听返回错误后重新等待事件的间隔
+	watchRetryInterval = time.Second
+)
+
+// 支持立即重新获取全部节点的监听
+type resyncer interface {
+	Resync()
+}
+
+// 基于 Watcher 的grpc解析器
+type watchResolver struct {
+	watcher Watcher
+	cc      resolver.ClientConn
+	logger  *zap.SugaredLogger
+	nodes   map[string]*Node // 事件key -> 节点
+	addrs   *AddressCache    // 事件key -> 地址，节点不变时复用
+	events  chan *Event
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewWatchResolver 根据服务节点变化监听创建grpc解析器，Close 时停止监听
+func NewWatchResolver(w Watcher, cc resolver.ClientConn, logger *zap.SugaredLogger) resolver.Resolver {
+	if logger == nil {
+		logger = zap.NewNop().Sugar()
+	}
+	r := &watchResolver{
+		watcher: w,
+		cc:      cc,
+		logger:  logger,
+		nodes:   make(map[string]*Node),
+		addrs:   NewAddressCache(),
+		events:  make(chan *Event),
+		done:    make(chan struct{}),
+	}
+	r.wg.Add(2)
+	go r.receive()
+	go r.run()
+	return r
+}
+
+// 接收变化事件
+func (r *watchResolver) receive() {
+	defer r.wg.Done()
+	for {
+		ev, err := r.watcher.Next()
+		if err == ErrWatcherStopped {
+			return
+		}
+		if err != nil {
+			r.logger.Errorw("服务节点监听错误", "err", err)
+			r.cc.ReportError(err)
+			select {
+			case <-time.After(watchRetryInterval):
+				continue
+			case <-r.done:
+				return
+			}
+		}
+		select {
+		case r.events <- ev:
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// 处理变化事件，合并连续到达的事件后推送完整地址列表
+func (r *watchResolver) run() {
+	defer r.wg.Done()
+	for {
+		select {
+		case ev := <-r.events:
+			r.apply(ev)
+		case <-r.done:
+			return
+		}
+	drain:
+		for {
+			select {
+			case ev := <-r.events:
+				r.apply(ev)
+			default:
+				break drain
+			}
+		}
+		r.updateState()
+	}
+}
+
+// 更新节点，同步完成事件不改变节点，只触发推送
+func (r *watchResolver) apply(ev *Event) {
+	switch ev.Type {
+	case EventAdd, EventUpdate:
+		r.nodes[ev.Key] = ev.Node
+	case EventRemove:
+		delete(r.nodes, ev.Key)
+	}
+}
+
+// 推送完整地址列表，按事件key排序，未变化的节点使用缓存的地址
+func (r *watchResolver) updateState() {
+	addrs, _ := r.addrs.Update(r.nodes)
+	r.cc.UpdateState(resolver.State{Addresses: addrs})
+}
+
+// ResolveNow 监听支持时立即重新获取全部节点
+func (r *watchResolver) ResolveNow(rn resolver.ResolveNowOptions) {
+	if rs, ok := r.watcher.(resyncer); ok {
+		rs.Resync()
+	}
+}
+
+// Close 停止监听
+func (r *watchResolver) Close() {
+	r.watcher.Stop()
+	close(r.done)
+	r.wg.Wait()
+}
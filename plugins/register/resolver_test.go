@@ -0,0 +1,137 @@
+package register
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// 测试用监听，事件和错误按写入顺序返回
+type testWatcher struct {
+	results chan testResult
+	done    chan struct{}
+}
+
+type testResult struct {
+	ev  *Event
+	err error
+}
+
+func newTestWatcher() *testWatcher {
+	return &testWatcher{
+		results: make(chan testResult, 16),
+		done:    make(chan struct{}),
+	}
+}
+
+func (w *testWatcher) Next() (*Event, error) {
+	select {
+	case r := <-w.results:
+		return r.ev, r.err
+	case <-w.done:
+		return nil, ErrWatcherStopped
+	}
+}
+
+func (w *testWatcher) Stop() {
+	close(w.done)
+}
+
+// 测试用连接，记录推送的地址列表和错误
+type testClientConn struct {
+	states chan resolver.State
+	errs   chan error
+}
+
+func newTestClientConn() *testClientConn {
+	return &testClientConn{
+		states: make(chan resolver.State, 16),
+		errs:   make(chan error, 16),
+	}
+}
+
+func (cc *testClientConn) UpdateState(s resolver.State)                         { cc.states <- s }
+func (cc *testClientConn) ReportError(err error)                                { cc.errs <- err }
+func (cc *testClientConn) NewAddress([]resolver.Address)                        {}
+func (cc *testClientConn) NewServiceConfig(string)                              {}
+func (cc *testClientConn) ParseServiceConfig(string) *serviceconfig.ParseResult { return nil }
+
+func (cc *testClientConn) nextState(t *testing.T) resolver.State {
+	t.Helper()
+	select {
+	case s := <-cc.states:
+		return s
+	case <-time.After(time.Second):
+		t.Fatal("等待推送地址列表超时")
+	}
+	return resolver.State{}
+}
+
+func TestWatchResolverSyncedWithoutNodes(t *testing.T) {
+	w := newTestWatcher()
+	cc := newTestClientConn()
+	r := NewWatchResolver(w, cc, nil)
+	defer r.Close()
+
+	w.results <- testResult{ev: &Event{Type: EventSynced}}
+	if s := cc.nextState(t); len(s.Addresses) != 0 {
+		t.Errorf("Addresses = %v, want empty", s.Addresses)
+	}
+}
+
+func TestWatchResolverEvents(t *testing.T) {
+	w := newTestWatcher()
+	cc := newTestClientConn()
+	r := NewWatchResolver(w, cc, nil)
+	defer r.Close()
+
+	w.results <- testResult{ev: &Event{Type: EventAdd, Key: "b", Node: &Node{Id: "b", Address: "b:1"}}}
+	w.results <- testResult{ev: &Event{Type: EventAdd, Key: "a", Node: &Node{Id: "a", Address: "a:1"}}}
+	w.results <- testResult{ev: &Event{Type: EventSynced}}
+	// 事件可能分多次推送，等待包含全部节点的地址列表
+	var s resolver.State
+	for len(s.Addresses) < 2 {
+		s = cc.nextState(t)
+	}
+	if s.Addresses[0].Addr != "a:1" || s.Addresses[1].Addr != "b:1" {
+		t.Errorf("Addresses = %v, want [a:1 b:1]", s.Addresses)
+	}
+
+	w.results <- testResult{ev: &Event{Type: EventRemove, Key: "b"}}
+	s = cc.nextState(t)
+	if len(s.Addresses) != 1 || s.Addresses[0].Addr != "a:1" {
+		t.Errorf("Addresses = %v, want [a:1]", s.Addresses)
+	}
+}
+
+func TestWatchResolverReportsError(t *testing.T) {
+	w := newTestWatcher()
+	cc := newTestClientConn()
+	r := NewWatchResolver(w, cc, nil)
+	defer r.Close()
+
+	errWatch := errors.New("watch failed")
+	w.results <- testResult{err: errWatch}
+	select {
+	case err := <-cc.errs:
+		if err != errWatch {
+			t.Errorf("ReportError(%v), want %v", err, errWatch)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("监听错误未通知连接")
+	}
+
+	// 错误后继续监听
+	w.results <- testResult{ev: &Event{Type: EventAdd, Key: "a", Node: &Node{Id: "a", Address: "a:1"}}}
+	select {
+	case s := <-cc.states:
+		if len(s.Addresses) != 1 {
+			t.Errorf("Addresses = %v, want [a:1]", s.Addresses)
+		}
+	case <-time.After(2 * watchRetryInterval):
+		t.Fatal("监听错误后不再推送地址列表")
+	}
+}
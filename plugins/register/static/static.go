@@ -0,0 +1,80 @@
+package static
+
+import (
+	"github.com/micro-kit/microkit/plugins/register"
+	"google.golang.org/grpc/resolver"
+)
+
+/*
+ 固定地址服务发现
+ 服务地址通过 register.Addrs 设置，注册和取消注册不做任何处理
+*/
+
+const (
+	// 默认 schema
+	defaultSchema = "static"
+)
+
+// Static 固定地址服务发现
+type Static struct {
+	Options *register.Options // 注册服务配置
+}
+
+// NewRegistry 创建固定地址服务发现，register.Addrs 为服务节点地址列表
+func NewRegistry(ops ...register.Option) register.Register {
+	s := &Static{
+		Options: new(register.Options),
+	}
+	for _, o := range ops {
+		o(s.Options)
+	}
+	if s.Options.Schema == "" {
+		s.Options.Schema = defaultSchema
+	}
+	return s
+}
+
+// Register 什么也不做
+func (s *Static) Register(n *register.Node) error {
+	return nil
+}
+
+// UnRegister 什么也不做
+func (s *Static) UnRegister(n *register.Node) error {
+	return nil
+}
+
+// GetResolver 获取客户端发现 grpc Resolver对象
+func (s *Static) GetResolver() resolver.Resolver {
+	return s
+}
+
+// GetBuilder 获取grpc服务注册Builder对象
+func (s *Static) GetBuilder() resolver.Builder {
+	return s
+}
+
+// Build grpc resolver接口需要 - 推送固定地址列表
+func (s *Static) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	addrs := make([]resolver.Address, 0, len(s.Options.Addrs))
+	for _, addr := range s.Options.Addrs {
+		addrs = append(addrs, register.NewAddress(&register.Node{
+			Id:        addr,
+			Address:   addr,
+			Advertise: addr,
+		}))
+	}
+	cc.UpdateState(resolver.State{Addresses: addrs})
+	return s, nil
+}
+
+// Scheme 相当于服务分类名
+func (s *Static) Scheme() string {
+	return s.Options.Schema
+}
+
+// ResolveNow 地址固定，什么也不做
+func (s *Static) ResolveNow(rn resolver.ResolveNowOptions) {}
+
+// Close 什么也不做
+func (s *Static) Close() {}
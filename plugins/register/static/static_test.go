@@ -0,0 +1,50 @@
+package static
+
+import (
+	"testing"
+
+	"github.com/micro-kit/microkit/plugins/register"
+	"google.golang.org/grpc/resolver"
+)
+
+// 测试用客户端连接，记录推送的地址列表
+type testClientConn struct {
+	resolver.ClientConn
+	states []resolver.State
+}
+
+func (cc *testClientConn) UpdateState(s resolver.State) {
+	cc.states = append(cc.states, s)
+}
+
+func TestResolver(t *testing.T) {
+	s := NewRegistry(register.Addrs("127.0.0.1:1", "127.0.0.1:2"))
+	if scheme := s.GetBuilder().Scheme(); scheme != defaultSchema {
+		t.Errorf("Scheme() = %s, want %s", scheme, defaultSchema)
+	}
+	cc := new(testClientConn)
+	r, err := s.GetBuilder().Build(resolver.Target{Endpoint: "svc"}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if len(cc.states) != 1 {
+		t.Fatalf("推送 %d 次地址列表, want 1", len(cc.states))
+	}
+	addrs := cc.states[0].Addresses
+	if len(addrs) != 2 || addrs[0].Addr != "127.0.0.1:1" || addrs[1].Addr != "127.0.0.1:2" {
+		t.Fatalf("Addresses = %v, want [127.0.0.1:1 127.0.0.1:2]", addrs)
+	}
+	// 地址携带节点信息，节点id为地址
+	n, ok := register.NodeFromAddress(addrs[0])
+	if !ok || n.Id != "127.0.0.1:1" {
+		t.Errorf("节点信息 = %+v, want id 127.0.0.1:1", n)
+	}
+	// 注册和取消注册不做任何处理
+	if err := s.Register(&register.Node{Id: "x"}); err != nil {
+		t.Errorf("Register() error = %v", err)
+	}
+	if err := s.UnRegister(&register.Node{Id: "x"}); err != nil {
+		t.Errorf("UnRegister() error = %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/micro-kit/micro-common/logger"
+	"github.com/micro-kit/microkit/plugins/register"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+/*
+ 管理接口
+ 使用独立的 http.ServeMux，监听 MetricsAddress
+ /metrics           普罗米修斯监控信息
+ /healthz           存活检查
+ /readyz            就绪检查，与grpc健康检查状态一致
+ /debug/pprof/*     性能分析
+ /debug/microkit    服务配置、中间件顺序、注册节点和运行时长
+*/
+
+// 管理接口服务信息
+type adminInfo struct {
+	ID              string         `json:"id"`
+	ServiceName     string         `json:"service_name"`
+	Address         string         `json:"address"`
+	Advertise       string         `json:"advertise"`
+	MetricsAddress  string         `json:"metrics_address"`
+	WriteBufSize    int            `json:"write_buf_size"`
+	ReadBufSize     int            `json:"read_buf_size"`
+	TLS             bool           `json:"tls"`
+	MutualTLS       bool           `json:"mutual_tls"`
+	ShutdownDelay   string         `json:"shutdown_delay"`
+	ShutdownTimeout string         `json:"shutdown_timeout"`
+	Signals         []string       `json:"signals"`
+	HealthCheckers  []string       `json:"health_checkers"`
+	Middlewares     []string       `json:"middlewares"` // 中间件执行顺序
+	Register        string         `json:"register"`
+	Node            *register.Node `json:"node"`
+	StartTime       time.Time      `json:"start_time"`
+	Uptime          string         `json:"uptime"`
+}
+
+// 创建管理接口服务
+func (s *Server) newAdminServer() *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/microkit", s.debugInfo)
+	return &http.Server{
+		Addr:    s.opts.metricsAddress,
+		Handler: mux,
+	}
+}
+
+// 启动管理接口
+func (s *Server) serveAdmin(lis net.Listener) {
+	err := s.adminServer.Serve(lis)
+	if err != nil && err != http.ErrServerClosed {
+		logger.Logger.Errorw("管理接口服务错误", "err", err, "address", s.opts.metricsAddress)
+	}
+}
+
+// 关闭管理接口
+func (s *Server) shutdownAdmin() {
+	if s.adminServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.shutdownTimeout)
+	defer cancel()
+	err := s.adminServer.Shutdown(ctx)
+	if err != nil {
+		logger.Logger.Errorw("关闭管理接口错误", "err", err, "address", s.opts.metricsAddress)
+	}
+}
+
+// 存活检查
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// 就绪检查
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	if s.healthServer != nil {
+		resp, err := s.healthServer.Check(r.Context(), &healthpb.HealthCheckRequest{})
+		if err == nil && resp.Status == healthpb.HealthCheckResponse_SERVING {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("ok"))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte("not ready"))
+}
+
+// 服务信息
+func (s *Server) debugInfo(w http.ResponseWriter, r *http.Request) {
+	info := &adminInfo{
+		ID:              s.opts.id,
+		ServiceName:     s.opts.serviceName,
+		Address:         s.opts.address,
+		Advertise:       s.opts.advertise,
+		MetricsAddress:  s.opts.metricsAddress,
+		WriteBufSize:    s.opts.writeBufSize,
+		ReadBufSize:     s.opts.readBufSize,
+		TLS:             s.opts.tlsCertFile != "",
+		MutualTLS:       s.opts.tlsClientCAFile != "",
+		ShutdownDelay:   s.opts.shutdownDelay.String(),
+		ShutdownTimeout: s.opts.shutdownTimeout.String(),
+		Register:        fmt.Sprintf("%T", s.opts.reg),
+		StartTime:       s.startTime,
+		Uptime:          time.Since(s.startTime).String(),
+	}
+	for _, sig := range s.opts.signals {
+		info.Signals = append(info.Signals, sig.String())
+	}
+	for name := range s.opts.healthCheckers {
+		info.HealthCheckers = append(info.HealthCheckers, name)
+	}
+	for _, m := range s.opts.middlewares {
+		info.Middlewares = append(info.Middlewares, fmt.Sprintf("%T", m))
+	}
+	s.mu.RLock()
+	if s.registered {
+		info.Node = s.node()
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(info)
+	if err != nil {
+		logger.Logger.Errorw("输出服务信息错误", "err", err)
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// 请求管理接口
+func adminGet(ts *testServer, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	ts.adminServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestAdminHealthz(t *testing.T) {
+	ts := startTestServer(t, func(*grpc.Server) {}, MetricsAddress("127.0.0.1:0"))
+	defer ts.Stop()
+	if rec := adminGet(ts, "/healthz"); rec.Code != http.StatusOK {
+		t.Errorf("/healthz code = %d, want %d", rec.Code, http.StatusOK)
+	}
+	// 未注册时仍然存活
+	ts.UnRegister()
+	if rec := adminGet(ts, "/healthz"); rec.Code != http.StatusOK {
+		t.Errorf("取消注册后 /healthz code = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestAdminReadyz(t *testing.T) {
+	ts := startTestServer(t, func(*grpc.Server) {}, MetricsAddress("127.0.0.1:0"))
+	defer ts.Stop()
+	if rec := adminGet(ts, "/readyz"); rec.Code != http.StatusOK {
+		t.Errorf("/readyz code = %d, want %d", rec.Code, http.StatusOK)
+	}
+	// 与grpc健康检查状态一致
+	ts.UnRegister()
+	if rec := adminGet(ts, "/readyz"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("取消注册后 /readyz code = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	ts.Register()
+	if rec := adminGet(ts, "/readyz"); rec.Code != http.StatusOK {
+		t.Errorf("重新注册后 /readyz code = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestAdminDebugInfo(t *testing.T) {
+	ts := startTestServer(t, func(*grpc.Server) {}, MetricsAddress("127.0.0.1:0"), Metadata("k", "v"))
+	defer ts.Stop()
+	rec := adminGet(ts, "/debug/microkit")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/debug/microkit code = %d, want %d", rec.Code, http.StatusOK)
+	}
+	info := new(adminInfo)
+	if err := json.Unmarshal(rec.Body.Bytes(), info); err != nil {
+		t.Fatal(err)
+	}
+	if info.ServiceName != "microkit.test" || info.ID != "microkit.test-1" {
+		t.Errorf("服务信息 = %s %s, want microkit.test microkit.test-1", info.ServiceName, info.ID)
+	}
+	if info.Node == nil || info.Node.Metadata["k"] != "v" {
+		t.Errorf("注册节点 = %+v, want metadata k=v", info.Node)
+	}
+}
+
+func TestAdminMetrics(t *testing.T) {
+	ts := startTestServer(t, func(*grpc.Server) {}, MetricsAddress("127.0.0.1:0"))
+	defer ts.Stop()
+	if rec := adminGet(ts, "/metrics"); rec.Code != http.StatusOK {
+		t.Errorf("/metrics code = %d, want %d", rec.Code, http.StatusOK)
+	}
+	// 不使用 http.DefaultServeMux
+	if _, pattern := http.DefaultServeMux.Handler(httptest.NewRequest(http.MethodGet, "/metrics", nil)); pattern != "" {
+		t.Errorf("/metrics 注册到了 http.DefaultServeMux")
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/micro-kit/micro-common/logger"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+/*
+ 健康检查
+ 注册标准 grpc.health.v1.Health 服务，状态跟随服务生命周期
+ 注册成功前和停止过程中为 NOT_SERVING，注册成功后为 SERVING，依赖检查失败时为 NOT_SERVING
+ 依赖检查只在后台定时执行，注册和停止时使用最近一次检查结果，不阻塞启动和停止流程
+*/
+
+// HealthChecker 依赖健康检查函数，返回错误表示依赖不可用
+type HealthChecker func(ctx context.Context) error
+
+// 初始化健康检查服务，调用方持有 s.mu
+func (s *Server) initHealth() {
+	s.healthServer = health.NewServer()
+	healthpb.RegisterHealthServer(s.grpcServer, s.healthServer)
+	s.setServingStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+// 设置注册状态并刷新健康状态
+func (s *Server) setRegistered(registered bool) {
+	s.mu.Lock()
+	s.registered = registered
+	s.mu.Unlock()
+	s.updateHealth()
+}
+
+// 服务是否可以接收请求 - 已注册且未停止
+func (s *Server) isServing() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.registered && !s.draining
+}
+
+// 根据生命周期和最近一次依赖检查结果刷新健康状态
+func (s *Server) updateHealth() {
+	if s.healthServer == nil {
+		return
+	}
+	s.mu.RLock()
+	healthy := s.dependencyErr == nil
+	s.mu.RUnlock()
+	status := healthpb.HealthCheckResponse_SERVING
+	if !s.isServing() || !healthy {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	s.setServingStatus(status)
+}
+
+// 执行依赖检查，保存检查结果并刷新健康状态
+func (s *Server) checkHealth() {
+	name, err := s.checkDependencies()
+	if err != nil {
+		logger.Logger.Warnw("依赖健康检查失败", "err", err, "checker", name, "service_name", s.opts.serviceName)
+	}
+	s.mu.Lock()
+	s.dependencyErr = err
+	s.mu.Unlock()
+	s.updateHealth()
+}
+
+// 执行全部依赖检查，返回第一个失败的检查名和错误
+func (s *Server) checkDependencies() (string, error) {
+	for name, checker := range s.opts.healthCheckers {
+		ctx, cancel := context.WithTimeout(context.Background(), s.opts.healthCheckInterval)
+		err := checker(ctx)
+		cancel()
+		if err != nil {
+			return name, err
+		}
+	}
+	return "", nil
+}
+
+// 设置整体和每个grpc服务的健康状态
+func (s *Server) setServingStatus(status healthpb.HealthCheckResponse_ServingStatus) {
+	s.healthServer.SetServingStatus("", status)
+	for name := range s.grpcServer.GetServiceInfo() {
+		s.healthServer.SetServingStatus(name, status)
+	}
+}
+
+// 启动后立即执行一次依赖检查，之后定时执行
+func (s *Server) watchHealth() {
+	if len(s.opts.healthCheckers) == 0 {
+		return
+	}
+	ticker := time.NewTicker(s.opts.healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		s.checkHealth()
+		select {
+		case <-ticker.C:
+		case <-s.stopped:
+			return
+		}
+	}
+}
+
+// 停止时设置为 NOT_SERVING，之后的状态更新将被忽略
+func (s *Server) drainHealth() {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+	if s.healthServer != nil {
+		s.healthServer.Shutdown()
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// 等待健康状态变为 want
+func waitStatus(t *testing.T, conn *grpc.ClientConn, want healthpb.HealthCheckResponse_ServingStatus) {
+	t.Helper()
+	client := healthpb.NewHealthClient(conn)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		if err == nil && resp.Status == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("健康状态 = %v (err %v), want %v", resp.GetStatus(), err, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHealthLifecycle(t *testing.T) {
+	ts := startTestServer(t, func(*grpc.Server) {}, ShutdownDelay(300*time.Millisecond))
+	conn := ts.dial(t)
+	defer conn.Close()
+	waitStatus(t, conn, healthpb.HealthCheckResponse_SERVING)
+
+	// 取消注册后不再接收请求
+	if err := ts.UnRegister(); err != nil {
+		t.Fatal(err)
+	}
+	ts.reg.wait(t, "unregister")
+	waitStatus(t, conn, healthpb.HealthCheckResponse_NOT_SERVING)
+	if err := ts.Register(); err != nil {
+		t.Fatal(err)
+	}
+	ts.reg.wait(t, "register")
+	waitStatus(t, conn, healthpb.HealthCheckResponse_SERVING)
+
+	// 停止过程中为 NOT_SERVING，之后重新注册也不会恢复
+	go ts.Stop()
+	ts.reg.wait(t, "unregister")
+	waitStatus(t, conn, healthpb.HealthCheckResponse_NOT_SERVING)
+	ts.setRegistered(true)
+	waitStatus(t, conn, healthpb.HealthCheckResponse_NOT_SERVING)
+	ts.waitServe(t)
+}
+
+func TestHealthDependency(t *testing.T) {
+	var failing int32
+	errDown := errors.New("dependency down")
+	checker := func(ctx context.Context) error {
+		if atomic.LoadInt32(&failing) == 1 {
+			return errDown
+		}
+		return nil
+	}
+	ts := startTestServer(t, func(*grpc.Server) {},
+		HealthCheck("db", checker),
+		HealthCheckInterval(20*time.Millisecond),
+	)
+	defer ts.Stop()
+	conn := ts.dial(t)
+	defer conn.Close()
+	waitStatus(t, conn, healthpb.HealthCheckResponse_SERVING)
+
+	atomic.StoreInt32(&failing, 1)
+	waitStatus(t, conn, healthpb.HealthCheckResponse_NOT_SERVING)
+	atomic.StoreInt32(&failing, 0)
+	waitStatus(t, conn, healthpb.HealthCheckResponse_SERVING)
+}
+
+func TestHealthCheckNotOnRegisterPath(t *testing.T) {
+	var calls int32
+	errDown := errors.New("dependency down")
+	checker := func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return errDown
+	}
+	ts := startTestServer(t, func(*grpc.Server) {},
+		HealthCheck("db", checker),
+		HealthCheckInterval(time.Hour),
+	)
+	conn := ts.dial(t)
+	defer conn.Close()
+	// 启动后后台执行一次依赖检查
+	for i := 0; atomic.LoadInt32(&calls) == 0; i++ {
+		if i > 200 {
+			t.Fatal("启动后未执行依赖检查")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitStatus(t, conn, healthpb.HealthCheckResponse_NOT_SERVING)
+
+	// 注册和停止使用最近一次检查结果，不执行依赖检查
+	if err := ts.UnRegister(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Register(); err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, conn, healthpb.HealthCheckResponse_NOT_SERVING)
+	ts.Stop()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("依赖检查执行 %d 次, want 1", n)
+	}
+}
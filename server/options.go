@@ -1,6 +1,12 @@
 package server
 
 import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
 	"github.com/micro-kit/microkit/plugins/middleware"
 	"github.com/micro-kit/microkit/plugins/register"
 )
@@ -11,6 +17,17 @@ const (
 	// 默认读写缓冲区 128KB
 	defaultWriteBufSize = 128 * 1024
 	defaultReadBufSize  = 128 * 1024
+	// 默认取消注册后等待注册信息传播时间
+	defaultShutdownDelay = 3 * time.Second
+	// 默认等待处理中请求完成的最长时间，超时后强制停止
+	defaultShutdownTimeout = 15 * time.Second
+	// 默认依赖健康检查间隔
+	defaultHealthCheckInterval = 10 * time.Second
+)
+
+var (
+	// 默认监听的退出信号
+	defaultSignals = []os.Signal{syscall.SIGTERM, syscall.SIGINT}
 )
 
 // Option 实例值设置
@@ -21,6 +38,7 @@ type Options struct {
 	id          string                  // 服务id
 	serviceName string                  // 服务名
 	address     string                  // 监听地址
+	listener    net.Listener            // 自定义监听，设置后忽略监听地址
 	advertise   string                  // 服务注册地址
 	middlewares []middleware.Middleware // 中间件
 	reg         register.Register       // 注册中间件
@@ -28,7 +46,20 @@ type Options struct {
 	writeBufSize int // 写缓冲区
 	readBufSize  int // 读缓冲区
 
-	metricsAddress string // 普罗米修斯监控信息接口
+	metricsAddress string // 管理接口监听地址，包含普罗米修斯监控信息
+
+	tlsCertFile     string // tls证书
+	tlsKeyFile      string // tls私钥
+	tlsClientCAFile string // 客户端ca证书，设置后启用 mTLS
+
+	shutdownDelay   time.Duration // 取消注册后等待注册信息传播时间
+	shutdownTimeout time.Duration // 优雅停止最长等待时间
+	signals         []os.Signal   // 监听的退出信号
+
+	healthCheckers      map[string]HealthChecker // 依赖健康检查
+	healthCheckInterval time.Duration            // 依赖健康检查间隔
+
+	metadata map[string]string // 服务注册附加信息
 }
 
 // Address 监听地址
@@ -38,6 +69,13 @@ func Address(address string) Option {
 	}
 }
 
+// Listener 使用自定义监听启动服务，例如测试时使用 bufconn
+func Listener(lis net.Listener) Option {
+	return func(o *Options) {
+		o.listener = lis
+	}
+}
+
 // Advertise 服务注册地址
 func Advertise(advertise string) Option {
 	return func(o *Options) {
@@ -87,9 +125,104 @@ func ReadBufSize(readBufSize int) Option {
 	}
 }
 
-// MetricsAddress 普罗米修斯监控信息接口
+// MetricsAddress 管理接口监听地址，提供 /metrics /healthz /readyz /debug/pprof /debug/microkit
 func MetricsAddress(metricsAddress string) Option {
 	return func(o *Options) {
 		o.metricsAddress = metricsAddress
 	}
 }
+
+// TLS 启用tls加密连接，证书文件变化后自动重新加载
+// 客户端默认按服务名验证证书，证书需要包含服务名的 SAN
+func TLS(certFile, keyFile string) Option {
+	return func(o *Options) {
+		o.tlsCertFile = certFile
+		o.tlsKeyFile = keyFile
+	}
+}
+
+// ClientCA 客户端ca证书，设置后要求客户端提供由该ca签发的证书(mTLS)，需同时设置 TLS
+func ClientCA(caFile string) Option {
+	return func(o *Options) {
+		o.tlsClientCAFile = caFile
+	}
+}
+
+// ShutdownDelay 取消注册后等待多久再停止服务，用于等待客户端感知节点下线，默认3秒，为0时不等待
+func ShutdownDelay(shutdownDelay time.Duration) Option {
+	return func(o *Options) {
+		o.shutdownDelay = shutdownDelay
+	}
+}
+
+// ShutdownTimeout 优雅停止最长等待时间，超时后强制停止
+func ShutdownTimeout(shutdownTimeout time.Duration) Option {
+	return func(o *Options) {
+		o.shutdownTimeout = shutdownTimeout
+	}
+}
+
+// Signals 监听的退出信号，默认 SIGTERM SIGINT
+func Signals(signals ...os.Signal) Option {
+	return func(o *Options) {
+		o.signals = signals
+	}
+}
+
+// HealthCheck 添加依赖健康检查，任一检查失败时健康状态为 NOT_SERVING
+func HealthCheck(name string, checker HealthChecker) Option {
+	return func(o *Options) {
+		if o.healthCheckers == nil {
+			o.healthCheckers = make(map[string]HealthChecker)
+		}
+		o.healthCheckers[name] = checker
+	}
+}
+
+// HealthCheckInterval 依赖健康检查间隔，同时作为单次检查超时时间
+func HealthCheckInterval(healthCheckInterval time.Duration) Option {
+	return func(o *Options) {
+		o.healthCheckInterval = healthCheckInterval
+	}
+}
+
+// 未设置时写入服务注册附加信息
+func (o *Options) setDefaultMetadata(key, value string) {
+	if _, ok := o.metadata[key]; ok {
+		return
+	}
+	if o.metadata == nil {
+		o.metadata = make(map[string]string)
+	}
+	o.metadata[key] = value
+}
+
+// Metadata 添加服务注册附加信息，客户端负载均衡器可根据附加信息选择节点
+func Metadata(key, value string) Option {
+	return func(o *Options) {
+		if o.metadata == nil {
+			o.metadata = make(map[string]string)
+		}
+		o.metadata[key] = value
+	}
+}
+
+// Weight 节点权重，写入服务注册附加信息，用于加权负载均衡
+func Weight(weight int) Option {
+	return Metadata(register.MetadataWeight, strconv.Itoa(weight))
+}
+
+// Zone 节点所在可用区，写入服务注册附加信息，默认从环境变量 SVC_ZONE 获取
+func Zone(zone string) Option {
+	return Metadata(register.MetadataZone, zone)
+}
+
+// Region 节点所在地域，写入服务注册附加信息，默认从环境变量 SVC_REGION 获取
+func Region(region string) Option {
+	return Metadata(register.MetadataRegion, region)
+}
+
+// Version 节点服务版本，写入服务注册附加信息，默认从环境变量 SVC_VERSION 获取
+func Version(version string) Option {
+	return Metadata(register.MetadataVersion, version)
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+/* 对端身份 - 启用 mTLS 后从已验证的客户端证书获取 */
+
+// PeerIdentity 经过证书验证的对端身份
+type PeerIdentity struct {
+	CommonName string   // 证书 CN
+	DNSNames   []string // 证书 SAN 域名
+	URIs       []string // 证书 SAN URI
+	SpiffeID   string   // spiffe:// 开头的 URI
+}
+
+// PeerIdentityFromContext 获取请求对端身份，未启用 mTLS 或证书未经验证时返回false
+func PeerIdentityFromContext(ctx context.Context) (*PeerIdentity, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.AuthInfo == nil {
+		return nil, false
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil, false
+	}
+	chains := tlsInfo.State.VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return nil, false
+	}
+	cert := chains[0][0]
+	identity := &PeerIdentity{
+		CommonName: cert.Subject.CommonName,
+		DNSNames:   cert.DNSNames,
+	}
+	for _, u := range cert.URIs {
+		identity.URIs = append(identity.URIs, u.String())
+		if u.Scheme == "spiffe" && identity.SpiffeID == "" {
+			identity.SpiffeID = u.String()
+		}
+	}
+	return identity, true
+}
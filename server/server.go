@@ -5,6 +5,10 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
 
 	"github.com/micro-kit/micro-common/config"
 	"github.com/micro-kit/micro-common/logger"
@@ -15,8 +19,9 @@ import (
 	"github.com/micro-kit/microkit/plugins/middleware/opentracing"
 	"github.com/micro-kit/microkit/plugins/middleware/prometheus"
 	"github.com/micro-kit/microkit/plugins/register"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
 )
 
 /*
@@ -26,11 +31,24 @@ import (
 
 var (
 	tracerCloser io.Closer // 链路追踪关闭
+	// ErrServerStopped 服务已停止后调用 Serve
+	ErrServerStopped = errors.New("Server has been stopped")
 )
 
 // Server 用于构造grpc服务，中间件加载等通用代码，简化应用创建过程
 type Server struct {
-	opts *Options
+	opts          *Options
+	grpcServer    *grpc.Server  // grpc 服务
+	adminServer   *http.Server  // 管理接口服务
+	stopOnce      sync.Once     // 保证只停止一次
+	stopped       chan struct{} // 停止完成通知
+	stopErr       error         // 停止过程中的错误
+	healthServer  *health.Server
+	mu            sync.RWMutex
+	registered    bool      // 是否已注册
+	draining      bool      // 是否正在停止
+	dependencyErr error     // 最近一次依赖检查错误
+	startTime     time.Time // 启动时间
 }
 
 // NewDefaultServer 创建加载默认中间件服务
@@ -46,18 +64,26 @@ func NewDefaultServer() (*Server, error) {
 		return nil, err
 	}
 	tracerCloser = closer
-	opts = append(opts, opentracing.NewOpentracing(
+	tracing, err := opentracing.NewOpentracing(
 		opentracing.Logger(logger.Logger),
 		opentracing.Tracer(tracer),
-	))
+	)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, tracing)
 	// 监控中间件
 	opts = append(opts, prometheus.NewPrometheus(prometheus.Enable(true)))
 	// 熔断限流中间件
-	opts = append(opts, hystrixlimitter.NewHystrixLimitter(
+	limitter, err := hystrixlimitter.NewHystrixLimitter(
 		hystrixlimitter.Type(hystrixlimitter.HystrixLimitterTypeServer),
 		hystrixlimitter.Logger(logger.Logger),
 		hystrixlimitter.ServiceName(serviceName),
-	))
+	)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, limitter)
 
 	return NewServer(Middleware(opts...), MetricsAddress(":19999"))
 }
@@ -65,15 +91,21 @@ func NewDefaultServer() (*Server, error) {
 // NewServer 创建一个grpc服务对象
 func NewServer(opts ...Option) (*Server, error) {
 	s := &Server{
-		opts: new(Options),
+		opts:    new(Options),
+		stopped: make(chan struct{}),
 	}
 	// 配置
-	configure(s, opts...)
+	err := configure(s, opts...)
+	if err != nil {
+		return nil, err
+	}
 	return s, nil
 }
 
 // 配置设置项
-func configure(s *Server, ops ...Option) {
+func configure(s *Server, ops ...Option) error {
+	// 允许设置为0的参数在设置前赋默认值
+	s.opts.shutdownDelay = defaultShutdownDelay
 	// 处理设置参数
 	for _, o := range ops {
 		o(s.opts)
@@ -97,10 +129,35 @@ func configure(s *Server, ops ...Option) {
 	if s.opts.readBufSize <= 0 {
 		s.opts.readBufSize = defaultReadBufSize
 	}
+	if s.opts.shutdownTimeout <= 0 {
+		s.opts.shutdownTimeout = defaultShutdownTimeout
+	}
+	if s.opts.healthCheckInterval <= 0 {
+		s.opts.healthCheckInterval = defaultHealthCheckInterval
+	}
+	if len(s.opts.signals) == 0 {
+		s.opts.signals = defaultSignals
+	}
+	// 节点所在可用区和地域，用于客户端优先调用同可用区节点
+	if zone := common.GetZone(); zone != "" {
+		s.opts.setDefaultMetadata(register.MetadataZone, zone)
+	}
+	if region := common.GetRegion(); region != "" {
+		s.opts.setDefaultMetadata(register.MetadataRegion, region)
+	}
+	// 服务版本，用于客户端按版本路由
+	if version := common.GetVersion(); version != "" {
+		s.opts.setDefaultMetadata(register.MetadataVersion, version)
+	}
 	if s.opts.reg == nil {
 		// 默认注册到etcdv3
-		s.opts.reg = common.NewServerEtcdRegister()
+		reg, err := common.NewServerEtcdRegister()
+		if err != nil {
+			return err
+		}
+		s.opts.reg = reg
 	}
+	return nil
 }
 
 // RegisterServer 注册服务回调 - 用于注册服务的grpc服务方法
@@ -111,11 +168,34 @@ func (s *Server) Serve(regServer ...RegisterServer) error {
 	if len(regServer) == 0 {
 		return errors.New("At least one RegisterServer passed in")
 	}
-	// 监听
-	lis, err := net.Listen("tcp", s.opts.address)
+	// 已停止的服务不能再启动
+	select {
+	case <-s.stopped:
+		return ErrServerStopped
+	default:
+	}
+	// tls加密连接
+	creds, err := s.transportCredentials()
 	if err != nil {
 		return err
 	}
+	// 监听
+	lis := s.opts.listener
+	if lis == nil {
+		lis, err = net.Listen("tcp", s.opts.address)
+		if err != nil {
+			return err
+		}
+	}
+	// 管理接口监听
+	var adminLis net.Listener
+	if s.opts.metricsAddress != "" {
+		adminLis, err = net.Listen("tcp", s.opts.metricsAddress)
+		if err != nil {
+			lis.Close()
+			return err
+		}
+	}
 	// 组织流式调用和普通调用插件列表
 	streamInterceptors := make([]grpc.StreamServerInterceptor, 0)
 	unaryInterceptors := make([]grpc.UnaryServerInterceptor, 0)
@@ -124,63 +204,195 @@ func (s *Server) Serve(regServer ...RegisterServer) error {
 		unaryInterceptors = append(unaryInterceptors, v.UnaryHandler)
 	}
 	// 创建grpc server并设置中间件
-	grpcServer := grpc.NewServer(
+	serverOpts := []grpc.ServerOption{
 		grpc.StreamInterceptor(middleware.ChainStreamServer(streamInterceptors...)),
 		grpc.UnaryInterceptor(middleware.ChainUnaryServer(unaryInterceptors...)),
 		grpc.WriteBufferSize(s.opts.writeBufSize),
 		grpc.ReadBufferSize(s.opts.readBufSize),
-	)
+	}
+	if creds != nil {
+		serverOpts = append(serverOpts, grpc.Creds(creds))
+	}
+	grpcServer := grpc.NewServer(serverOpts...)
 	// 注册grpc服务实现
 	for _, regSrv := range regServer {
 		regSrv(grpcServer)
 	}
+	// 与 Stop 互斥设置服务对象，已开始停止时不再启动
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		if adminLis != nil {
+			adminLis.Close()
+		}
+		lis.Close()
+		return ErrServerStopped
+	}
+	s.grpcServer = grpcServer
+	s.startTime = time.Now()
+	// 注册健康检查服务
+	s.initHealth()
+	if adminLis != nil {
+		s.adminServer = s.newAdminServer()
+	}
+	s.mu.Unlock()
+	// 启动管理接口
+	if adminLis != nil {
+		go s.serveAdmin(adminLis)
+	}
 	// 注册服务
 	err = s.Register()
 	if err != nil {
+		s.shutdownAdmin()
+		lis.Close()
 		return err
 	}
-	// 启动普罗米修斯监控接口
-	go s.Metrics()
+	// 注册期间开始停止时停止流程可能先于注册取消注册，重新取消注册后等待停止完成
+	s.mu.RLock()
+	draining := s.draining
+	s.mu.RUnlock()
+	if draining {
+		if err := s.UnRegister(); err != nil {
+			logger.Logger.Errorw("取消注册服务错误", "err", err, "service_name", s.opts.serviceName, "id", s.opts.id)
+		}
+		lis.Close()
+		<-s.stopped
+		return ErrServerStopped
+	}
+	// 监听退出信号
+	go s.handleSignals()
+	// 定时依赖检查
+	go s.watchHealth()
 
 	logger.Logger.Infow("启动服务", "service_name", s.opts.serviceName, "id", s.opts.id, "advertise", s.opts.advertise)
-	// 启动服务
-	return grpcServer.Serve(lis)
+	// 启动服务 - 调用 Stop 后返回
+	err = s.grpcServer.Serve(lis)
+	if err == grpc.ErrServerStopped {
+		// 启动前已调用 Stop，等待停止流程完成
+		<-s.stopped
+		return ErrServerStopped
+	}
+	if err != nil {
+		// 服务异常退出时执行停止流程，取消注册并关闭管理接口
+		logger.Logger.Errorw("服务异常退出", "err", err, "service_name", s.opts.serviceName, "id", s.opts.id)
+		s.Stop()
+		return err
+	}
+	// 等待停止流程执行完成
+	<-s.stopped
+	return s.stopErr
 }
 
-// Register 注册服务
-func (s *Server) Register() error {
-	return s.opts.reg.Register(&register.Node{
+// tls证书，未设置时返回nil使用非加密连接
+func (s *Server) transportCredentials() (credentials.TransportCredentials, error) {
+	if s.opts.tlsCertFile == "" {
+		if s.opts.tlsClientCAFile != "" {
+			return nil, errors.New("ClientCA requires TLS certificate")
+		}
+		return nil, nil
+	}
+	reloader, err := common.NewTLSReloader(s.opts.tlsCertFile, s.opts.tlsKeyFile, s.opts.tlsClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	return reloader.ServerCredentials(), nil
+}
+
+// 监听退出信号，收到信号后停止服务
+func (s *Server) handleSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, s.opts.signals...)
+	defer signal.Stop(ch)
+	select {
+	case sig := <-ch:
+		logger.Logger.Infow("收到退出信号，停止服务", "signal", sig.String(), "service_name", s.opts.serviceName, "id", s.opts.id)
+		s.Stop()
+	case <-s.stopped:
+	}
+}
+
+// 服务注册节点信息
+func (s *Server) node() *register.Node {
+	var metadata map[string]string
+	if len(s.opts.metadata) > 0 {
+		metadata = make(map[string]string, len(s.opts.metadata))
+		for k, v := range s.opts.metadata {
+			metadata[k] = v
+		}
+	}
+	return &register.Node{
 		Id:        s.opts.id,
 		Address:   s.opts.address,
 		Advertise: s.opts.advertise,
-	})
+		Metadata:  metadata,
+	}
+}
+
+// Register 注册服务
+func (s *Server) Register() error {
+	err := s.opts.reg.Register(s.node())
+	if err != nil {
+		return err
+	}
+	s.setRegistered(true)
+	return nil
 }
 
 // UnRegister 取消注册信息
 func (s *Server) UnRegister() error {
-	if tracerCloser != nil {
-		tracerCloser.Close()
-	}
-	return s.opts.reg.UnRegister(&register.Node{
-		Id:        s.opts.id,
-		Address:   s.opts.address,
-		Advertise: s.opts.advertise,
-	})
+	s.setRegistered(false)
+	return s.opts.reg.UnRegister(s.node())
 }
 
 // Stop 停止服务
+// 先取消注册，等待注册信息传播后优雅停止grpc服务，超时则强制停止，最后关闭管理接口和链路追踪
 func (s *Server) Stop() error {
+	s.stopOnce.Do(func() {
+		s.stopErr = s.shutdown()
+		close(s.stopped)
+	})
+	<-s.stopped
+	return s.stopErr
+}
+
+// 停止流程
+func (s *Server) shutdown() error {
+	// 健康检查设置为 NOT_SERVING，之后 Serve 不再设置服务对象
+	s.drainHealth()
+	// 取消注册，使客户端不再发送新请求
 	err := s.UnRegister()
 	if err != nil {
-		return err
+		logger.Logger.Errorw("取消注册服务错误", "err", err, "service_name", s.opts.serviceName, "id", s.opts.id)
 	}
-	return nil
+	// 等待注册信息传播到客户端
+	if s.grpcServer != nil {
+		time.Sleep(s.opts.shutdownDelay)
+		s.gracefulStop()
+	}
+	// 关闭管理接口
+	s.shutdownAdmin()
+	// 链路追踪
+	if tracerCloser != nil {
+		if e := tracerCloser.Close(); e != nil {
+			logger.Logger.Errorw("关闭链路追踪错误", "err", e, "service_name", s.opts.serviceName)
+		}
+	}
+	logger.Logger.Infow("服务已停止", "service_name", s.opts.serviceName, "id", s.opts.id)
+	return err
 }
 
-// Metrics 普罗米修斯监控信息接口
-func (s *Server) Metrics() {
-	if s.opts.metricsAddress != "" {
-		http.Handle("/metrics", promhttp.Handler())
-		http.ListenAndServe(s.opts.metricsAddress, nil)
+// 优雅停止grpc服务，等待处理中请求完成，超时后强制停止
+func (s *Server) gracefulStop() {
+	done := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(s.opts.shutdownTimeout):
+		logger.Logger.Warnw("等待请求处理完成超时，强制停止服务", "timeout", s.opts.shutdownTimeout, "service_name", s.opts.serviceName)
+		s.grpcServer.Stop()
+		<-done
 	}
 }
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/micro-kit/microkit/plugins/register"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	// 测试慢请求方法
+	waitMethod = "/microkit.test.Slow/Wait"
+)
+
+// 测试用服务注册，按顺序记录注册和取消注册
+type recordRegister struct {
+	ch chan string
+}
+
+func newRecordRegister() *recordRegister {
+	return &recordRegister{ch: make(chan string, 16)}
+}
+
+func (r *recordRegister) Register(n *register.Node) error {
+	r.ch <- "register"
+	return nil
+}
+
+func (r *recordRegister) UnRegister(n *register.Node) error {
+	r.ch <- "unregister"
+	return nil
+}
+
+func (r *recordRegister) GetResolver() resolver.Resolver { return nil }
+func (r *recordRegister) GetBuilder() resolver.Builder   { return nil }
+
+// 等待下一次注册或取消注册
+func (r *recordRegister) wait(t *testing.T, want string) {
+	t.Helper()
+	select {
+	case ev := <-r.ch:
+		if ev != want {
+			t.Fatalf("注册事件 = %s, want %s", ev, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("等待注册事件 %s 超时", want)
+	}
+}
+
+// 测试慢请求服务，收到请求后通知 started，等待 release 后返回
+type slowService struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newSlowService() *slowService {
+	return &slowService{
+		started: make(chan struct{}, 16),
+		release: make(chan struct{}),
+	}
+}
+
+func (s *slowService) wait(ctx context.Context, req *empty.Empty) (*empty.Empty, error) {
+	s.started <- struct{}{}
+	select {
+	case <-s.release:
+		return req, nil
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+func (s *slowService) register(grpcServer *grpc.Server) {
+	grpcServer.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "microkit.test.Slow",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Wait",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(empty.Empty)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return s.wait(ctx, req.(*empty.Empty))
+				}
+				if interceptor == nil {
+					return handler(ctx, in)
+				}
+				return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: waitMethod}, handler)
+			},
+		}},
+	}, s)
+}
+
+// 测试服务端，监听 bufconn
+type testServer struct {
+	*Server
+	reg      *recordRegister
+	lis      *bufconn.Listener
+	serveErr chan error
+}
+
+// 创建并启动测试服务端，注册完成后返回
+func startTestServer(t *testing.T, regServer RegisterServer, opts ...Option) *testServer {
+	t.Helper()
+	ts := &testServer{
+		reg:      newRecordRegister(),
+		lis:      bufconn.Listen(1024 * 1024),
+		serveErr: make(chan error, 1),
+	}
+	defaults := []Option{
+		ServiceName("microkit.test"),
+		ID("microkit.test-1"),
+		Listener(ts.lis),
+		Register(ts.reg),
+		ShutdownDelay(0),
+	}
+	s, err := NewServer(append(defaults, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Server = s
+	go func() {
+		ts.serveErr <- s.Serve(regServer)
+	}()
+	ts.reg.wait(t, "register")
+	return ts
+}
+
+// 连接测试服务端
+func (ts *testServer) dial(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return ts.lis.Dial()
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// 等待 Serve 返回
+func (ts *testServer) waitServe(t *testing.T) error {
+	t.Helper()
+	select {
+	case err := <-ts.serveErr:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待 Serve 返回超时")
+	}
+	return nil
+}
+
+func TestServeAfterStop(t *testing.T) {
+	s, err := NewServer(Register(newRecordRegister()), ShutdownDelay(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Stop(); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if err := s.Serve(func(*grpc.Server) {}); err != ErrServerStopped {
+		t.Errorf("Serve() error = %v, want %v", err, ErrServerStopped)
+	}
+}
+
+func TestServeWithoutRegisterServer(t *testing.T) {
+	s, err := NewServer(Register(newRecordRegister()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Serve(); err == nil {
+		t.Error("Serve() 未传入 RegisterServer 时未返回错误")
+	}
+}
+
+func TestStopDrainsInflightRequests(t *testing.T) {
+	slow := newSlowService()
+	ts := startTestServer(t, slow.register, ShutdownDelay(100*time.Millisecond))
+	conn := ts.dial(t)
+	defer conn.Close()
+
+	callErr := make(chan error, 1)
+	go func() {
+		callErr <- conn.Invoke(context.Background(), waitMethod, new(empty.Empty), new(empty.Empty))
+	}()
+	<-slow.started
+
+	stopErr := make(chan error, 1)
+	go func() {
+		stopErr <- ts.Stop()
+	}()
+	// 先取消注册，等待注册信息传播期间仍然处理新请求
+	ts.reg.wait(t, "unregister")
+	_, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Errorf("取消注册后等待传播期间 Check() error = %v", err)
+	}
+	// 处理中请求完成前不停止
+	select {
+	case err := <-stopErr:
+		t.Fatalf("处理中请求完成前 Stop() 返回 %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	close(slow.release)
+	if err := <-callErr; err != nil {
+		t.Errorf("处理中请求 error = %v", err)
+	}
+	if err := <-stopErr; err != nil {
+		t.Errorf("Stop() error = %v", err)
+	}
+	if err := ts.waitServe(t); err != nil {
+		t.Errorf("Serve() error = %v", err)
+	}
+	// 再次停止直接返回
+	if err := ts.Stop(); err != nil {
+		t.Errorf("重复 Stop() error = %v", err)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	slow := newSlowService()
+	ts := startTestServer(t, slow.register, ShutdownTimeout(100*time.Millisecond))
+	conn := ts.dial(t)
+	defer conn.Close()
+
+	callErr := make(chan error, 1)
+	go func() {
+		callErr <- conn.Invoke(context.Background(), waitMethod, new(empty.Empty), new(empty.Empty))
+	}()
+	<-slow.started
+
+	begin := time.Now()
+	ts.Stop()
+	if elapsed := time.Since(begin); elapsed > 2*time.Second {
+		t.Errorf("Stop() 耗时 %v, 超时后未强制停止", elapsed)
+	}
+	if err := <-callErr; status.Code(err) != codes.Unavailable && status.Code(err) != codes.Canceled {
+		t.Errorf("强制停止后处理中请求 error = %v, want Unavailable or Canceled", err)
+	}
+	ts.waitServe(t)
+}
+
+// 注册失败的服务注册
+type failRegister struct{}
+
+func (r failRegister) Register(n *register.Node) error   { return errors.New("register failed") }
+func (r failRegister) UnRegister(n *register.Node) error { return nil }
+func (r failRegister) GetResolver() resolver.Resolver    { return nil }
+func (r failRegister) GetBuilder() resolver.Builder      { return nil }
+
+func TestServeRegisterError(t *testing.T) {
+	s, err := NewServer(Listener(bufconn.Listen(1024)), Register(failRegister{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Serve(func(*grpc.Server) {}); err == nil || err.Error() != "register failed" {
+		t.Errorf("Serve() error = %v, want register failed", err)
+	}
+}
+
+func TestServeClientCAWithoutTLS(t *testing.T) {
+	s, err := NewServer(Listener(bufconn.Listen(1024)), Register(newRecordRegister()), ClientCA("ca.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Serve(func(*grpc.Server) {}); err == nil {
+		t.Error("Serve() 只设置客户端ca证书时未返回错误")
+	}
+}
@@ -0,0 +1,41 @@
+package testing
+
+import (
+	"context"
+
+	"github.com/micro-kit/microkit/plugins/middleware"
+	"google.golang.org/grpc"
+)
+
+// UnaryServerMiddleware 只包含非流式服务端拦截器的中间件，其它调用直接透传
+// 用于在测试中模拟服务端变慢、返回错误等情况
+func UnaryServerMiddleware(interceptor grpc.UnaryServerInterceptor) middleware.Middleware {
+	return &unaryServerMiddleware{
+		interceptor: interceptor,
+	}
+}
+
+// 非流式服务端拦截器中间件
+type unaryServerMiddleware struct {
+	interceptor grpc.UnaryServerInterceptor
+}
+
+// UnaryHandler 调用拦截器
+func (m *unaryServerMiddleware) UnaryHandler(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return m.interceptor(ctx, req, info, handler)
+}
+
+// StreamHandler 直接透传
+func (m *unaryServerMiddleware) StreamHandler(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, stream)
+}
+
+// UnaryClient 直接透传
+func (m *unaryServerMiddleware) UnaryClient(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// StreamClient 直接透传
+func (m *unaryServerMiddleware) StreamClient(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(ctx, desc, cc, method, opts...)
+}
@@ -0,0 +1,75 @@
+package testing
+
+import (
+	"time"
+
+	"github.com/micro-kit/microkit/client"
+	"github.com/micro-kit/microkit/plugins/middleware"
+	"github.com/micro-kit/microkit/server"
+)
+
+/* 测试工具配置 */
+
+const (
+	// 默认服务名
+	defaultServiceName = "microkit.testing"
+	// 默认 bufconn 缓冲区 1MB
+	defaultBufSize = 1024 * 1024
+	// 默认等待服务就绪时间
+	defaultReadyTimeout = 5 * time.Second
+)
+
+// Option 实例值设置
+type Option func(*Options)
+
+// Options 测试工具相关参数
+type Options struct {
+	serviceName   string                  // 服务名
+	middlewares   []middleware.Middleware // 服务端和客户端中间件，未设置时只使用空链路追踪中间件
+	bufSize       int                     // bufconn 缓冲区
+	readyTimeout  time.Duration           // 等待服务就绪时间
+	serverOptions []server.Option         // 附加服务端配置
+	clientOptions []client.Option         // 附加客户端配置
+}
+
+// ServiceName 服务名
+func ServiceName(serviceName string) Option {
+	return func(o *Options) {
+		o.serviceName = serviceName
+	}
+}
+
+// Middleware 服务端和客户端中间件
+func Middleware(middlewares ...middleware.Middleware) Option {
+	return func(o *Options) {
+		o.middlewares = middlewares
+	}
+}
+
+// BufSize bufconn 缓冲区大小
+func BufSize(bufSize int) Option {
+	return func(o *Options) {
+		o.bufSize = bufSize
+	}
+}
+
+// ReadyTimeout 等待服务就绪时间
+func ReadyTimeout(readyTimeout time.Duration) Option {
+	return func(o *Options) {
+		o.readyTimeout = readyTimeout
+	}
+}
+
+// ServerOption 附加服务端配置，在测试工具默认配置之后生效
+func ServerOption(opts ...server.Option) Option {
+	return func(o *Options) {
+		o.serverOptions = opts
+	}
+}
+
+// ClientOption 附加客户端配置，在测试工具默认配置之后生效
+func ClientOption(opts ...client.Option) Option {
+	return func(o *Options) {
+		o.clientOptions = opts
+	}
+}
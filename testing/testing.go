@@ -0,0 +1,175 @@
+package testing
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/micro-kit/micro-common/logger"
+	"github.com/micro-kit/microkit/client"
+	"github.com/micro-kit/microkit/plugins/middleware"
+	"github.com/micro-kit/microkit/plugins/middleware/opentracing"
+	"github.com/micro-kit/microkit/plugins/register"
+	"github.com/micro-kit/microkit/plugins/register/memory"
+	"github.com/micro-kit/microkit/server"
+	opentracingGo "github.com/opentracing/opentracing-go"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+/*
+ 测试工具
+ 服务端监听 bufconn，使用进程内服务注册和空链路追踪，不依赖 etcd jaeger 和本地端口
+ 返回已连接到服务端的客户端对象
+*/
+
+var (
+	// 每个测试工具使用独立的 schema，并行测试互不影响
+	harnessSeq int64
+)
+
+// Harness 测试工具，包含已启动的服务端和已连接的客户端
+type Harness struct {
+	Options  *Options
+	Server   *server.Server
+	Client   *client.Client
+	listener *bufconn.Listener
+	serveErr chan error
+}
+
+// NewHarness 启动服务端并连接客户端，服务就绪后返回
+func NewHarness(regServer server.RegisterServer, opts ...Option) (*Harness, error) {
+	h := &Harness{
+		Options:  new(Options),
+		serveErr: make(chan error, 1),
+	}
+	// 配置
+	err := configure(h, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	seq := atomic.AddInt64(&harnessSeq, 1)
+	schema := fmt.Sprintf("microkit-testing-%d", seq)
+	h.listener = bufconn.Listen(h.Options.bufSize)
+
+	// 服务端
+	serverOpts := []server.Option{
+		server.ServiceName(h.Options.serviceName),
+		server.ID(fmt.Sprintf("%s-%d", h.Options.serviceName, seq)),
+		server.Address(h.listener.Addr().String()),
+		server.Advertise(h.listener.Addr().String()),
+		server.Listener(h.listener),
+		server.Middleware(h.Options.middlewares...),
+		server.Register(memory.NewRegistry(
+			register.Name(h.Options.serviceName),
+			register.Schema(schema),
+		)),
+		server.ShutdownDelay(time.Millisecond),
+	}
+	s, err := server.NewServer(append(serverOpts, h.Options.serverOptions...)...)
+	if err != nil {
+		return nil, err
+	}
+	h.Server = s
+	go func() {
+		h.serveErr <- s.Serve(regServer)
+	}()
+
+	// 客户端
+	clientOpts := []client.Option{
+		client.ServiceName(h.Options.serviceName),
+		client.Middleware(h.Options.middlewares...),
+		client.Register(memory.NewRegistry(
+			register.Name(h.Options.serviceName),
+			register.Schema(schema),
+		)),
+		client.DialOption(grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return h.listener.Dial()
+		})),
+	}
+	c, err := client.NewClient(append(clientOpts, h.Options.clientOptions...)...)
+	if err != nil {
+		h.Server.Stop()
+		h.listener.Close()
+		return nil, err
+	}
+	h.Client = c
+	err = c.Dial()
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	// 等待服务就绪
+	err = h.waitReady()
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+// 配置设置项
+func configure(h *Harness, ops ...Option) error {
+	for _, o := range ops {
+		o(h.Options)
+	}
+	// 默认值
+	if h.Options.serviceName == "" {
+		h.Options.serviceName = defaultServiceName
+	}
+	if h.Options.bufSize <= 0 {
+		h.Options.bufSize = defaultBufSize
+	}
+	if h.Options.readyTimeout <= 0 {
+		h.Options.readyTimeout = defaultReadyTimeout
+	}
+	if h.Options.middlewares == nil {
+		tracing, err := opentracing.NewOpentracing(
+			opentracing.Logger(logger.Logger),
+			opentracing.Tracer(opentracingGo.NoopTracer{}),
+		)
+		if err != nil {
+			return err
+		}
+		h.Options.middlewares = []middleware.Middleware{tracing}
+	}
+	return nil
+}
+
+// 通过健康检查等待服务注册完成
+func (h *Harness) waitReady() error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.Options.readyTimeout)
+	defer cancel()
+	healthClient := healthpb.NewHealthClient(h.Client.Conn())
+	for {
+		resp, err := healthClient.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+		if err == nil && resp.Status == healthpb.HealthCheckResponse_SERVING {
+			return nil
+		}
+		select {
+		case err = <-h.serveErr:
+			return fmt.Errorf("服务启动失败: %v", err)
+		case <-ctx.Done():
+			return fmt.Errorf("等待服务就绪超时: %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// Conn 获取已连接到服务端的grpc连接，用于创建grpc客户端
+func (h *Harness) Conn() *grpc.ClientConn {
+	return h.Client.Conn()
+}
+
+// Close 关闭客户端并停止服务端
+func (h *Harness) Close() error {
+	h.Client.Close()
+	err := h.Server.Stop()
+	h.listener.Close()
+	return err
+}